@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"mangasearch/internal/db"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	apikeyName  string
+	apikeyScope string
+)
+
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys",
+	Long: `Creates, lists and revokes the keys the API server accepts. Keys with the search scope can
+search and browse; admin keys can also rebuild and correct pages. These commands talk to
+PostgreSQL directly, so they work before any key exists.`,
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:     "create",
+	Short:   "Create a key and print it once",
+	Args:    cobra.NoArgs,
+	Example: `  mangasearch apikey create --name laptop --scope admin`,
+	Run: func(cmd *cobra.Command, args []string) {
+		database := openDB()
+		key, k, err := database.CreateAPIKey(context.Background(), apikeyName, apikeyScope)
+		if err != nil {
+			log.Fatalf("❌  %v", err)
+		}
+		fmt.Printf("✓  Created key %d (%s, %s scope):\n\n    %s\n\n", k.ID, k.Name, k.Scope, key)
+		fmt.Println("It won't be shown again. Put it in API_KEY to use it from the CLI.")
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		database := openDB()
+		keys, err := database.ListAPIKeys(context.Background())
+		if err != nil {
+			log.Fatalf("❌  %v", err)
+		}
+		if len(keys) == 0 {
+			fmt.Println("No API keys yet. Create one with `mangasearch apikey create`.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tKEY\tSCOPE\tCREATED\tLAST USED\tSTATUS")
+		for _, k := range keys {
+			lastUsed, status := "never", "active"
+			if k.LastUsedAt != nil {
+				lastUsed = k.LastUsedAt.Local().Format(time.DateTime)
+			}
+			if k.RevokedAt != nil {
+				status = "revoked " + k.RevokedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s…\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Scope, k.CreatedAt.Local().Format(time.DateTime), lastUsed, status)
+		}
+		w.Flush()
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:     "revoke [id]",
+	Short:   "Revoke a key",
+	Args:    cobra.ExactArgs(1),
+	Example: `  mangasearch apikey revoke 3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			log.Fatalf("❌  Invalid key id %q", args[0])
+		}
+		database := openDB()
+		ok, err := database.RevokeAPIKey(context.Background(), id)
+		if err != nil {
+			log.Fatalf("❌  %v", err)
+		}
+		if !ok {
+			log.Fatalf("❌  No active key with id %d", id)
+		}
+		fmt.Printf("✓  Key %d revoked.\n", id)
+	},
+}
+
+// openDB connects to PostgreSQL and makes sure the schema is current.
+func openDB() *db.DB {
+	database, err := db.New(cfg.PostgresDSN)
+	if err != nil {
+		log.Fatalf("❌  postgres: %v", err)
+	}
+	if err := database.CreateSchema(context.Background()); err != nil {
+		log.Fatalf("❌  schema: %v", err)
+	}
+	return database
+}
+
+func init() {
+	apikeyCreateCmd.Flags().StringVar(&apikeyName, "name", "default", "label to recognise the key by")
+	apikeyCreateCmd.Flags().StringVar(&apikeyScope, "scope", db.ScopeSearch, "search or admin")
+	apikeyCmd.AddCommand(apikeyCreateCmd, apikeyListCmd, apikeyRevokeCmd)
+}
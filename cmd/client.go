@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// apiEndpoint is the URL of path, e.g. "/status", on the API server at
+// API_URL.
+func apiEndpoint(path string) string {
+	return strings.TrimSuffix(cfg.APIURL, "/") + path
+}
+
+var (
+	apiClientOnce sync.Once
+	apiClient     *http.Client
+	apiClientErr  error
+)
+
+// newAPIClient trusts API_CA_CERT on top of the system roots, for servers
+// behind a private CA.
+func newAPIClient() (*http.Client, error) {
+	if cfg.APICACert == "" {
+		return http.DefaultClient, nil
+	}
+	pem, err := os.ReadFile(cfg.APICACert)
+	if err != nil {
+		return nil, fmt.Errorf("api ca cert: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("api ca cert %s: no certificates found", cfg.APICACert)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
+
+// apiDo sends req to the API server with the configured API key.
+func apiDo(req *http.Request) (*http.Response, error) {
+	apiClientOnce.Do(func() { apiClient, apiClientErr = newAPIClient() })
+	if apiClientErr != nil {
+		return nil, apiClientErr
+	}
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	return apiClient.Do(req)
+}
+
+func apiGet(apiURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return apiDo(req)
+}
+
+func apiPost(apiURL, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return apiDo(req)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"mangasearch/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show or check the configuration",
+	// Subcommands load the config themselves so a broken one can be
+	// reported instead of stopping the command.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the settings in effect, with secrets masked",
+	Long: `Prints every setting after the environment, .env and the config file are
+merged, as YAML that can be used as a config file. Passwords and keys are
+masked.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if cfg.File != "" {
+			fmt.Printf("# from %s, environment and .env take precedence\n", cfg.File)
+		} else {
+			fmt.Printf("# no config file found, searched: %s\n", strings.Join(config.SearchPaths(), ", "))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, s := range cfg.Settings() {
+			fmt.Fprintf(w, "%s:\t%s\n", s.Key, strconv.Quote(s.Value))
+		}
+		return w.Flush()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration and report every problem",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("config is invalid:\n%w", err)
+		}
+		source := cfg.File
+		if source == "" {
+			source = "environment"
+		}
+		fmt.Printf("✓ config is valid (%s)\n", source)
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	correctAuthor  string
+	correctRevert  bool
+	correctHistory bool
+)
+
+var correctCmd = &cobra.Command{
+	Use:   "correct [page-id] [text]",
+	Short: "Replace a page's OCR text with a human correction",
+	Long: `Stores a correction in front of the OCR text of a page and reindexes it. Re-OCR keeps the
+correction unless the rebuild is run with --discard-corrections. Reads the text from stdin when
+it isn't given as an argument.`,
+	Args: cobra.RangeArgs(1, 2),
+	Example: `  mangasearch correct 1234 "I sacrifice"
+  mangasearch correct 1234 < fixed.txt
+  mangasearch correct 1234 --revert
+  mangasearch correct 1234 --history`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pageURL := apiEndpoint("/pages/" + url.PathEscape(args[0]))
+
+		if correctHistory {
+			var history []struct {
+				OldText   *string   `json:"old_text"`
+				NewText   *string   `json:"new_text"`
+				Author    string    `json:"author"`
+				CreatedAt time.Time `json:"created_at"`
+			}
+			getJSON(pageURL+"/history", &history)
+			if len(history) == 0 {
+				fmt.Println("No corrections.")
+				return
+			}
+			for _, h := range history {
+				author := h.Author
+				if author == "" {
+					author = "unknown"
+				}
+				if h.NewText == nil {
+					fmt.Printf("%s  %s removed the correction\n", h.CreatedAt.Local().Format(time.DateTime), author)
+					continue
+				}
+				fmt.Printf("%s  %s: %q\n", h.CreatedAt.Local().Format(time.DateTime), author, *h.NewText)
+			}
+			return
+		}
+
+		var req *http.Request
+		var err error
+		if correctRevert {
+			req, err = http.NewRequest(http.MethodDelete, pageURL+"/text?author="+url.QueryEscape(correctAuthor), nil)
+		} else {
+			text := ""
+			if len(args) == 2 {
+				text = args[1]
+			} else {
+				raw, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					log.Fatalf("❌  Reading stdin: %v", err)
+				}
+				text = strings.TrimRight(string(raw), "\n")
+			}
+			body, _ := json.Marshal(map[string]string{"text": text, "author": correctAuthor})
+			req, err = http.NewRequest(http.MethodPut, pageURL+"/text", bytes.NewReader(body))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+		}
+		if err != nil {
+			log.Fatalf("❌  %v", err)
+		}
+
+		resp, err := apiDo(req)
+		if err != nil {
+			log.Fatalf("❌  Can't reach the API server. Is mangasearch running? (%v)", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("❌  Correction failed: %s", string(body))
+		}
+
+		if correctRevert {
+			fmt.Println("✓  Correction removed; the OCR text is searchable again.")
+		} else {
+			fmt.Println("✓  Correction saved and indexed.")
+		}
+	},
+}
+
+func init() {
+	user := os.Getenv("USER")
+	correctCmd.Flags().StringVar(&correctAuthor, "author", user, "name recorded in the edit history when API auth is off; with it on, the API key's name is")
+	correctCmd.Flags().BoolVar(&correctRevert, "revert", false, "remove the correction and go back to the OCR text")
+	correctCmd.Flags().BoolVar(&correctHistory, "history", false, "show the edit history of the page")
+}
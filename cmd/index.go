@@ -2,18 +2,17 @@ package cmd
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"mangasearch/internal/api"
 	"mangasearch/internal/db"
 	"mangasearch/internal/ocr"
 	"mangasearch/internal/queue"
-	"mangasearch/internal/search"
 	"mangasearch/internal/startup"
-	"mangasearch/internal/watcher"
+	"mangasearch/internal/textblock"
 	"github.com/spf13/cobra"
 )
 
+var indexConfirm bool
+
 var indexCmd = &cobra.Command{
 	Use:   "index",
 	Short: "One-time scan and index of your manga folder",
@@ -21,43 +20,66 @@ var indexCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 
-		if err := startup.Boot(ctx, cfg); err != nil {
-			log.Fatalf("❌  boot: %v", err)
+		if noDocker {
+			cfg.ManageDocker = false
+		}
+		if err := cfg.Validate(); err != nil {
+			fatal("invalid config", err)
+		}
+		libs, err := cfg.Layouts()
+		if err != nil {
+			fatal("invalid config", err)
+		}
+		checkImageConverter()
+		esClient, err := newSearchClient()
+		if err != nil {
+			fatal("elasticsearch failed", err)
+		}
+		redisOpts, err := queue.RedisOptions(cfg.RedisURL, cfg.RedisPassword)
+		if err != nil {
+			fatal("redis failed", err)
+		}
+		if err := startup.Boot(ctx, cfg, esClient, logger); err != nil {
+			fatal("boot failed", err)
 		}
 
 		dbClient, err := db.New(cfg.PostgresDSN)
 		if err != nil {
-			log.Fatalf("❌  postgres: %v", err)
+			fatal("postgres failed", err)
 		}
 		if err := dbClient.CreateSchema(ctx); err != nil {
-			log.Fatalf("❌  schema: %v", err)
+			fatal("schema failed", err)
 		}
 
-		esAddr := fmt.Sprintf("http://localhost:%d", cfg.ESPort)
-		esClient, err := search.New(esAddr)
-		if err != nil {
-			log.Fatalf("❌  elasticsearch: %v", err)
-		}
 		if err := esClient.InitIndex(ctx); err != nil {
-			log.Fatalf("❌  elasticsearch index: %v", err)
+			fatal("elasticsearch index failed", err)
 		}
 
-		ocrClient := ocr.NewClient(cfg.OCRPort, cfg.MangaFolder, cfg.MangaFolderContainer)
-		redisClient := queue.NewRedisQueue(cfg.Workers, cfg.RedisAddr, dbClient, esClient, ocrClient)
-		watcherClient := watcher.NewWatcher(cfg.MangaFolder)
-		server := api.NewServer(cfg, dbClient, esClient, ocrClient, redisClient, watcherClient)
+		ocrClient := ocr.NewClient(cfg.OCRURL, cfg.MangaFolder, cfg.MangaFolderContainer, logger)
+		redisClient := queue.NewRedisQueue(cfg.Workers, cfg.OCRBatchSize, cfg.OCRBatchWait, redisOpts, libs, dbClient, esClient, ocrClient, newPipeline(), newResolver(), textblock.Options{RightToLeft: cfg.RightToLeft, Proximity: cfg.BlockProximity}, nil, logger)
+		server := api.NewServer(cfg, dbClient, esClient, ocrClient, redisClient, libs, nil, logger)
 
-		log.Println("[index] Scanning...")
-		pushed, err := server.RunScan()
+		logger.Info("scanning")
+		var pushed int
+		if indexConfirm {
+			pushed, err = server.ConfirmDeletions("")
+		} else {
+			pushed, err = server.RunScan()
+		}
 		if err != nil {
-			log.Fatalf("❌  scan failed: %v", err)
+			fatal("scan failed", err)
 		}
 
 		if pushed == 0 {
-			log.Println("[index] Nothing new. All caught up.")
+			logger.Info("nothing new, all caught up")
 			return
 		}
 
-		log.Printf("[index] ✓ Done. %d files indexed.", pushed)
+		logger.Info("done", "indexed", pushed)
 	},
 }
+
+func init() {
+	indexCmd.Flags().BoolVar(&indexConfirm, "confirm-deletions", false, "delete pages missing from disk even past delete_threshold")
+	indexCmd.Flags().BoolVar(&noDocker, "no-docker", false, "don't run docker compose; use services that are already running (same as MANAGE_DOCKER=false)")
+}
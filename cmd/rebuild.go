@@ -6,15 +6,60 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"github.com/spf13/cobra"
 )
 
+var (
+	rebuildNoCache bool
+	rebuildDiscard bool
+	rebuildLibrary string
+	rebuildSeries  string
+	rebuildChapter string
+	rebuildPrefix  string
+)
+
 var rebuildCmd = &cobra.Command{
 	Use:   "rebuild-index",
 	Short: "Wipe and re-index everything from scratch",
-	Long:  `Deletes all rows from Postgres, wipes the Elasticsearch index, then re-scans and re-indexes everything.`,
+	Long: `Deletes all rows from Postgres, wipes the Elasticsearch index, then re-scans and re-indexes everything.
+With --library, --series, --chapter or --prefix only the matching pages are deleted and re-indexed.`,
+	Example: `  mangasearch rebuild-index
+  mangasearch rebuild-index --series Vagabond --no-cache
+  mangasearch rebuild-index --library comics
+  mangasearch rebuild-index --series Berserk --chapter Chapter_057
+  mangasearch rebuild-index --prefix /mnt/manga/raws/`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("⚠️  This wipes all indexed data and starts over.")
+		if rebuildChapter != "" && rebuildSeries == "" {
+			log.Fatalf("❌  --chapter needs --series")
+		}
+
+		query := url.Values{}
+		if rebuildNoCache {
+			query.Set("no_cache", "true")
+		}
+		if rebuildDiscard {
+			query.Set("discard_corrections", "true")
+		}
+		if rebuildLibrary != "" {
+			query.Set("library", rebuildLibrary)
+		}
+		if rebuildSeries != "" {
+			query.Set("series", rebuildSeries)
+		}
+		if rebuildChapter != "" {
+			query.Set("chapter", rebuildChapter)
+		}
+		if rebuildPrefix != "" {
+			query.Set("prefix", rebuildPrefix)
+		}
+
+		scoped := rebuildLibrary != "" || rebuildSeries != "" || rebuildPrefix != ""
+		if scoped {
+			fmt.Println("⚠️  This wipes and re-indexes the selected pages.")
+		} else {
+			fmt.Println("⚠️  This wipes all indexed data and starts over.")
+		}
 		fmt.Print("Continue? (y/N): ")
 
 		var confirm string
@@ -24,9 +69,12 @@ var rebuildCmd = &cobra.Command{
 			return
 		}
 
-		apiURL := fmt.Sprintf("http://localhost:%d/rebuild", cfg.APIPort)
+		apiURL := apiEndpoint("/rebuild")
+		if len(query) > 0 {
+			apiURL += "?" + query.Encode()
+		}
 
-		resp, err := http.Post(apiURL, "application/json", nil)
+		resp, err := apiPost(apiURL, "application/json", nil)
 		if err != nil {
 			log.Fatalf("❌  Can't reach the API server. Is mangasearch running? (%v)", err)
 		}
@@ -43,7 +91,19 @@ var rebuildCmd = &cobra.Command{
 			log.Fatalf("❌  Bad response: %v", err)
 		}
 
+		if scoped {
+			log.Printf("[rebuild] ✓ %v pages deleted.", result["deleted_pages"])
+		}
 		log.Printf("[rebuild] ✓ %v files queued.", result["queued_jobs"])
 		log.Println("[rebuild] Run `mangasearch status` to track progress.")
 	},
 }
+
+func init() {
+	rebuildCmd.Flags().BoolVar(&rebuildNoCache, "no-cache", false, "re-run OCR instead of reusing cached results")
+	rebuildCmd.Flags().BoolVar(&rebuildDiscard, "discard-corrections", false, "drop human corrections of the re-indexed pages")
+	rebuildCmd.Flags().StringVar(&rebuildLibrary, "library", "", "only rebuild this library")
+	rebuildCmd.Flags().StringVar(&rebuildSeries, "series", "", "only rebuild this series")
+	rebuildCmd.Flags().StringVar(&rebuildChapter, "chapter", "", "only rebuild this chapter (needs --series)")
+	rebuildCmd.Flags().StringVar(&rebuildPrefix, "prefix", "", "only rebuild files whose path starts with this")
+}
@@ -1,13 +1,24 @@
 package cmd
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"mangasearch/internal/config"
+	"mangasearch/internal/container"
+	"mangasearch/internal/logging"
 	"github.com/spf13/cobra"
 )
 
 var cfg *config.Config
 
+// configPath is the --config flag; empty means search the usual places.
+var configPath string
+
+// logger is what the long-running commands log through. Client commands
+// print for humans instead.
+var logger *slog.Logger
+
 var rootCmd = &cobra.Command{
 	Use:   "mangasearch",
 	Short: "Search your manga collection by quote",
@@ -17,20 +28,57 @@ var rootCmd = &cobra.Command{
   mangasearch index                one-time scan and index
   mangasearch search "I sacrifice" find that panel
   mangasearch status               see what's indexed and in queue
-  mangasearch rebuild-index        wipe and re-index everything`,
+  mangasearch series               list indexed series
+  mangasearch chapters Berserk     list a series' chapters
+  mangasearch rebuild-index        wipe and re-index everything
+  mangasearch scan --dry-run       preview what the next scan indexes and deletes
+  mangasearch scan --explain PATH  say why a file is or isn't scanned
+  mangasearch config show          print the settings in effect`,
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
 }
 
-func Execute(c *config.Config) {
-	cfg = c
+func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+func loadConfig() error {
+	c, err := config.Load(".env", configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	l, err := logging.New(os.Stderr, c.LogFormat, c.LogLevel)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	cfg, logger = c, l
+	container.PDFDPI = c.PDFDPI
+	return nil
+}
+
+// fatal logs err and exits. slog has no Fatal of its own.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
 func init() {
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(indexCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(rebuildCmd)
+	rootCmd.AddCommand(seriesCmd)
+	rootCmd.AddCommand(chaptersCmd)
+	rootCmd.AddCommand(tailCmd)
+	rootCmd.AddCommand(correctCmd)
+	rootCmd.AddCommand(apikeyCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(scanCmd)
+
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file (default: $XDG_CONFIG_HOME/mangasearch/config.yaml, then /etc/mangasearch)")
 }
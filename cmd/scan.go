@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"mangasearch/internal/api"
+	"mangasearch/internal/db"
+	"mangasearch/internal/watcher"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanExplain        string
+	scanDryRun         bool
+	scanExport         string
+	scanApplyDeletions bool
+	scanYes            bool
+	scanPageTime       time.Duration
+	scanConfirm        bool
+	scanReport         bool
+	scanLibrary        string
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Inspect what a scan of your libraries picks up",
+	Long: `Looks at your libraries the way the watcher does, without indexing anything.
+
+--explain says whether a file or folder is scanned, and which ignore rule
+(from a .mangasearchignore file or the ignore setting) decides it.
+
+--dry-run compares the libraries with Postgres and lists, per series, the
+pages a scan would queue for OCR and the pages it would delete, with a rough
+OCR time. Nothing is queued and Redis is never contacted. --apply-deletions
+then deletes just the pages that are gone from disk.
+
+--report prints the running server's last scan of each library: folders and
+files seen, how long it took, and every folder, file or archive it couldn't
+read.
+
+--confirm-deletions tells the running server to go ahead with a scan it held
+back for deleting more than delete_threshold of a library's pages.`,
+	Example: `  mangasearch scan --explain "/path/to/your/manga/Berserk/@eaDir/001.png"
+  mangasearch scan --dry-run
+  mangasearch scan --dry-run --export plan.json
+  mangasearch scan --dry-run --apply-deletions
+  mangasearch scan --report
+  mangasearch scan --confirm-deletions --library comics`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case scanExplain != "":
+			return explain(scanExplain)
+		case scanConfirm:
+			return confirmDeletions(scanLibrary)
+		case scanReport:
+			return printReports()
+		case scanDryRun:
+			return dryRun()
+		case scanApplyDeletions:
+			return errors.New("--apply-deletions needs --dry-run")
+		}
+		return errors.New("nothing to do: pass --dry-run, --report, --confirm-deletions or --explain <path>")
+	},
+}
+
+// scanPlan is what --export writes.
+type scanPlan struct {
+	ToIndex  planPart `json:"to_index"`
+	ToDelete planPart `json:"to_delete"`
+}
+
+type planPart struct {
+	Pages            int               `json:"pages"`
+	EstimatedSeconds float64           `json:"estimated_seconds,omitempty"`
+	Series           []api.SeriesPages `json:"series"`
+}
+
+func dryRun() error {
+	ctx := context.Background()
+	libs, err := cfg.Layouts()
+	if err != nil {
+		return err
+	}
+	checkImageConverter()
+	dbClient, err := db.New(cfg.PostgresDSN)
+	if err != nil {
+		return err
+	}
+	defer dbClient.Close()
+	esClient, err := newSearchClient()
+	if err != nil {
+		return err
+	}
+	server := api.NewServer(cfg, dbClient, esClient, nil, nil, libs, nil, logger)
+
+	toIndex, toDelete, held, err := server.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	// Each worker sends its own batches, so they share the estimate.
+	estimate := time.Duration(len(toIndex)) * scanPageTime / time.Duration(max(cfg.Workers, 1))
+	plan := scanPlan{
+		ToIndex:  planPart{Pages: len(toIndex), EstimatedSeconds: estimate.Seconds(), Series: api.GroupBySeries(libs, toIndex)},
+		ToDelete: planPart{Pages: len(toDelete), Series: api.GroupBySeries(libs, toDelete)},
+	}
+
+	if scanExport != "" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(scanExport, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Plan written to %s\n", scanExport)
+	}
+	printPlan(plan, estimate)
+	for _, tooMany := range held {
+		fmt.Printf("\n⚠️  %s\n   A scan would hold these deletions back; check the folder is mounted.\n", tooMany)
+	}
+
+	if !scanApplyDeletions {
+		fmt.Println("\nDry run: nothing was queued or deleted.")
+		return nil
+	}
+	if len(toDelete) == 0 {
+		fmt.Println("\nNothing to delete.")
+		return nil
+	}
+	// A held library usually means a missing mount; a stray "y" mustn't
+	// wipe it.
+	if len(held) > 0 && !scanYes {
+		return errors.New("refusing to apply deletions a scan would hold back; check the folders are mounted, then pass --yes to delete anyway")
+	}
+	if !scanYes {
+		fmt.Printf("\nDelete %d pages from Postgres and Elasticsearch? (y/N): ", len(toDelete))
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "y" && confirm != "Y" {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+	server.DeletePages(toDelete)
+	fmt.Printf("✓ %d pages deleted. Nothing was queued.\n", len(toDelete))
+	return nil
+}
+
+func printPlan(plan scanPlan, estimate time.Duration) {
+	fmt.Printf("\nTo index: %d pages in %d series", plan.ToIndex.Pages, len(plan.ToIndex.Series))
+	if plan.ToIndex.Pages > 0 {
+		fmt.Printf(" (about %s of OCR at %s a page, workers: %d)", estimate.Round(time.Second), scanPageTime, cfg.Workers)
+	}
+	fmt.Println()
+	printSeries(plan.ToIndex.Series)
+	fmt.Printf("\nTo delete: %d pages in %d series\n", plan.ToDelete.Pages, len(plan.ToDelete.Series))
+	printSeries(plan.ToDelete.Series)
+}
+
+func printSeries(groups []api.SeriesPages) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, g := range groups {
+		series := g.Series
+		if series == "" {
+			series = "(outside the layout)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d\n", series, g.Library, len(g.Paths))
+	}
+	w.Flush()
+}
+
+func confirmDeletions(library string) error {
+	if !scanYes {
+		fmt.Println("⚠️  The held scan deletes every page it can't find on disk.")
+		fmt.Print("Continue? (y/N): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "y" && confirm != "Y" {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+	apiURL := apiEndpoint("/scan/confirm")
+	if library != "" {
+		apiURL += "?" + url.Values{"library": {library}}.Encode()
+	}
+	resp, err := apiPost(apiURL, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("can't reach the API server, is mangasearch running? (%w)", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Message    string `json:"message"`
+		QueuedJobs int    `json:"queued_jobs"`
+		Error      string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirm failed: %s", result.Error)
+	}
+	fmt.Printf("✓ %s, %d pages queued\n", result.Message, result.QueuedJobs)
+	return nil
+}
+
+func printReports() error {
+	var body struct {
+		Libraries []api.LibraryReport `json:"libraries"`
+	}
+	if err := fetchJSON(apiEndpoint("/scan/report"), &body); err != nil {
+		return err
+	}
+	for _, r := range body.Libraries {
+		fmt.Printf("%s (%s)\n", r.Library, r.Root)
+		if r.StartedAt.IsZero() {
+			fmt.Println("  not scanned yet")
+			continue
+		}
+		if r.Error != "" {
+			fmt.Printf("  ❌ %s (%s)\n", r.Error, r.StartedAt.Format(time.DateTime))
+			continue
+		}
+		fmt.Printf("  %s, took %s: %d folders, %d files, %d pages",
+			r.StartedAt.Format(time.DateTime), time.Duration(r.DurationSeconds*float64(time.Second)).Round(time.Millisecond),
+			r.Dirs, r.Files, r.Pages)
+		if r.SymlinksSkipped > 0 {
+			fmt.Printf(", %d symlinks skipped", r.SymlinksSkipped)
+		}
+		fmt.Println()
+		if r.ErrorCount == 0 {
+			continue
+		}
+		fmt.Printf("  %d errors:\n", r.ErrorCount)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, e := range r.Errors {
+			fmt.Fprintf(w, "    %s\t%s\t%s\n", e.Op, e.Path, e.Error)
+		}
+		w.Flush()
+		if n := r.ErrorCount - len(r.Errors); n > 0 {
+			fmt.Printf("    ... and %d more\n", n)
+		}
+	}
+	return nil
+}
+
+func explain(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	libs, err := cfg.Layouts()
+	if err != nil {
+		return err
+	}
+	lib, ok := libs.Find(path)
+	if !ok {
+		fmt.Printf("✗ %s\n  not inside any library\n", path)
+		return nil
+	}
+	w := watcher.NewWatcher(lib.Root, api.WatcherOptions(cfg), logger)
+	included, reason, err := w.Explain(path)
+	if err != nil {
+		return err
+	}
+	mark := "✗"
+	if included {
+		mark = "✓"
+	}
+	fmt.Printf("%s %s (library %s)\n  %s\n", mark, path, lib.Name, reason)
+	return nil
+}
+
+func init() {
+	scanCmd.Flags().StringVar(&scanExplain, "explain", "", "say whether this file or folder is scanned, and why")
+	scanCmd.Flags().BoolVar(&scanDryRun, "dry-run", false, "list what a scan would index and delete, without doing it")
+	scanCmd.Flags().StringVar(&scanExport, "export", "", "with --dry-run, also write the full plan as JSON to this file")
+	scanCmd.Flags().BoolVar(&scanApplyDeletions, "apply-deletions", false, "with --dry-run, delete the pages that are gone from disk; nothing is queued")
+	scanCmd.Flags().BoolVar(&scanYes, "yes", false, "don't ask before applying or confirming deletions")
+	scanCmd.Flags().BoolVar(&scanReport, "report", false, "print the running server's last scan report")
+	scanCmd.Flags().BoolVar(&scanConfirm, "confirm-deletions", false, "let the running server go ahead with a scan held back for deleting too much")
+	scanCmd.Flags().StringVar(&scanLibrary, "library", "", "with --confirm-deletions, only confirm this library's scan")
+	scanCmd.Flags().DurationVar(&scanPageTime, "page-time", 3*time.Second, "OCR time per page for the estimate")
+}
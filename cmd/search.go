@@ -11,6 +11,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	searchLibrary string
+	searchSeries  string
+	searchChapter string
+)
+
 var searchCmd = &cobra.Command{
 	Use:     "search [query]",
 	Short:   "Search your manga collection by quote",
@@ -19,13 +25,19 @@ var searchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		query := args[0]
 
-		apiURL := fmt.Sprintf(
-			"http://localhost:%d/search?q=%s",
-			cfg.APIPort,
-			url.QueryEscape(query),
-		)
+		params := url.Values{"q": {query}}
+		if searchLibrary != "" {
+			params.Set("library", searchLibrary)
+		}
+		if searchSeries != "" {
+			params.Set("series", searchSeries)
+		}
+		if searchChapter != "" {
+			params.Set("chapter", searchChapter)
+		}
+		apiURL := apiEndpoint("/search?" + params.Encode())
 
-		resp, err := http.Get(apiURL)
+		resp, err := apiGet(apiURL)
 		if err != nil {
 			log.Fatalf("❌  Can't reach the API server. Is mangasearch running? (%v)", err)
 		}
@@ -49,14 +61,30 @@ var searchCmd = &cobra.Command{
 
 		fmt.Printf("\nResults for \"%s\":\n\n", query)
 		for i, r := range results {
+			quote := r["block"]
+			if quote == nil {
+				quote = r["text"]
+			}
+			corrected := ""
+			if r["corrected"] == true {
+				corrected = " ✎ corrected"
+			}
 			fmt.Printf(
-				"  %d. %s — Chapter %v, Page %v\n     \"%v\"\n\n",
+				"  %d. %s — Chapter %v, Page %v (id %v)%s\n     \"%v\"\n\n",
 				i+1,
 				r["series"],
 				r["chapter"],
 				r["page"],
-				r["text"],
+				r["id"],
+				corrected,
+				quote,
 			)
 		}
 	},
 }
+
+func init() {
+	searchCmd.Flags().StringVar(&searchLibrary, "library", "", "only search this library")
+	searchCmd.Flags().StringVar(&searchSeries, "series", "", "only search this series")
+	searchCmd.Flags().StringVar(&searchChapter, "chapter", "", "only search this chapter")
+}
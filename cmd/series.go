@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var seriesCmd = &cobra.Command{
+	Use:   "series",
+	Short: "List indexed series with page and chapter counts",
+	Run: func(cmd *cobra.Command, args []string) {
+		apiURL := apiEndpoint("/series")
+
+		var series []struct {
+			Library     string    `json:"library"`
+			Series      string    `json:"series"`
+			Chapters    int       `json:"chapters"`
+			Pages       int       `json:"pages"`
+			Failed      int       `json:"failed"`
+			LastIndexed time.Time `json:"last_indexed"`
+		}
+		getJSON(apiURL, &series)
+
+		if len(series) == 0 {
+			fmt.Println("Nothing indexed yet.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "LIBRARY\tSERIES\tCHAPTERS\tPAGES\tFAILED\tLAST INDEXED")
+		for _, s := range series {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", s.Library, s.Series, s.Chapters, s.Pages, s.Failed, s.LastIndexed.Local().Format(time.DateTime))
+		}
+		w.Flush()
+	},
+}
+
+var chaptersCmd = &cobra.Command{
+	Use:     "chapters [series]",
+	Short:   "List the indexed chapters of a series",
+	Args:    cobra.ExactArgs(1),
+	Example: `  mangasearch chapters Berserk`,
+	Run: func(cmd *cobra.Command, args []string) {
+		apiURL := apiEndpoint("/series/" + url.PathEscape(args[0]) + "/chapters")
+
+		var chapters []struct {
+			Chapter     string    `json:"chapter"`
+			Pages       int       `json:"pages"`
+			Failed      int       `json:"failed"`
+			LastIndexed time.Time `json:"last_indexed"`
+		}
+		getJSON(apiURL, &chapters)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHAPTER\tPAGES\tFAILED\tLAST INDEXED")
+		for _, c := range chapters {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", c.Chapter, c.Pages, c.Failed, c.LastIndexed.Local().Format(time.DateTime))
+		}
+		w.Flush()
+	},
+}
+
+// getJSON fetches apiURL and decodes it into out, exiting on any failure.
+func getJSON(apiURL string, out interface{}) {
+	if err := fetchJSON(apiURL, out); err != nil {
+		log.Fatalf("❌  %v", err)
+	}
+}
+
+// fetchJSON fetches apiURL and decodes it into out.
+func fetchJSON(apiURL string, out interface{}) error {
+	resp, err := apiGet(apiURL)
+	if err != nil {
+		return fmt.Errorf("Can't reach the API server. Is mangasearch running? (%v)", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request failed: %s", string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("Bad response: %v", err)
+	}
+	return nil
+}
@@ -2,26 +2,35 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 	"mangasearch/internal/api"
 	"mangasearch/internal/db"
+	"mangasearch/internal/events"
+	"mangasearch/internal/imageformat"
 	"mangasearch/internal/ocr"
+	"mangasearch/internal/preprocess"
 	"mangasearch/internal/queue"
 	"mangasearch/internal/search"
 	"mangasearch/internal/startup"
+	"mangasearch/internal/textblock"
 	"mangasearch/internal/watcher"
 	"github.com/spf13/cobra"
 )
 
 var withDocker bool
 
+// noDocker overrides MANAGE_DOCKER for one run of start or index.
+var noDocker bool
+
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Boot everything and start watching for new files",
@@ -29,83 +38,166 @@ var startCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 
-		if err := startup.Boot(ctx, cfg); err != nil {
-			log.Fatalf("❌  boot: %v", err)
+		if noDocker {
+			cfg.ManageDocker = false
+		}
+		if err := cfg.Validate(); err != nil {
+			fatal("invalid config", err)
+		}
+		libs, err := cfg.Layouts()
+		if err != nil {
+			fatal("invalid config", err)
+		}
+		checkImageConverter()
+		esClient, err := newSearchClient()
+		if err != nil {
+			fatal("elasticsearch failed", err)
+		}
+		redisOpts, err := queue.RedisOptions(cfg.RedisURL, cfg.RedisPassword)
+		if err != nil {
+			fatal("redis failed", err)
+		}
+		if err := startup.Boot(ctx, cfg, esClient, logger); err != nil {
+			fatal("boot failed", err)
 		}
 
 		dbClient, err := db.New(cfg.PostgresDSN)
 		if err != nil {
-			log.Fatalf("❌  postgres: %v", err)
+			fatal("postgres failed", err)
 		}
 		if err := dbClient.CreateSchema(ctx); err != nil {
-			log.Fatalf("❌  schema: %v", err)
+			fatal("schema failed", err)
 		}
-		log.Printf("✓  postgres connected")
+		logger.Info("postgres connected")
 
-		esAddr := fmt.Sprintf("http://localhost:%d", cfg.ESPort)
-		esClient, err := search.New(esAddr)
-		if err != nil {
-			log.Fatalf("❌  elasticsearch: %v", err)
+		if cfg.APIAuth {
+			if n, err := dbClient.CountAPIKeys(ctx); err == nil && n == 0 {
+				logger.Warn("API_AUTH is on but there are no API keys; every request will be refused. Create one with `mangasearch apikey create --scope admin`.")
+			}
 		}
+
 		if err := esClient.InitIndex(ctx); err != nil {
-			log.Fatalf("❌  elasticsearch index: %v", err)
+			fatal("elasticsearch index failed", err)
 		}
-		log.Printf("✓  elasticsearch connected")
+		logger.Info("elasticsearch connected")
 
-		ocrClient := ocr.NewClient(cfg.OCRPort, cfg.MangaFolder, cfg.MangaFolderContainer)
-		log.Printf("✓  ocr client configured")
+		bus := events.NewBus()
+		ocrClient := ocr.NewClient(cfg.OCRURL, cfg.MangaFolder, cfg.MangaFolderContainer, logger)
+		logger.Info("ocr client configured")
 
-		redisClient := queue.NewRedisQueue(cfg.Workers, cfg.RedisAddr, dbClient, esClient, ocrClient)
-		log.Printf("✓  redis connected")
+		redisClient := queue.NewRedisQueue(cfg.Workers, cfg.OCRBatchSize, cfg.OCRBatchWait, redisOpts, libs, dbClient, esClient, ocrClient, newPipeline(), newResolver(), textblock.Options{RightToLeft: cfg.RightToLeft, Proximity: cfg.BlockProximity}, bus, logger)
+		logger.Info("redis connected")
 
-		watcherClient := watcher.NewWatcher(cfg.MangaFolder)
-		server := api.NewServer(cfg, dbClient, esClient, ocrClient, redisClient, watcherClient)
+		server := api.NewServer(cfg, dbClient, esClient, ocrClient, redisClient, libs, bus, logger)
 
-		log.Println("[start] Running initial scan...")
+		logger.Info("running initial scan")
 		if _, err := server.RunScan(); err != nil {
-			log.Fatalf("❌  initial scan: %v", err)
+			var tooMany *watcher.TooManyDeletionsError
+			if !errors.As(err, &tooMany) {
+				fatal("initial scan failed", err)
+			}
+			logger.Warn("initial scan held back, run mangasearch scan --confirm-deletions if the pages are really gone", "error", err)
 		}
-		log.Println("[start] Initial scan done.")
+		logger.Info("initial scan done")
 
 		server.StartWatcher()
-		log.Println("[start] Watcher running.")
+		logger.Info("watcher running", "libraries", len(libs), "interval", cfg.WatcherInterval)
 
 		go func() {
-			log.Println("[start] API server starting...")
+			logger.Info("api server starting", "host", cfg.APIHost, "port", cfg.APIPort)
 			if err := server.Run(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("[start] API server died: %v", err)
+				fatal("api server died", err)
 			}
 		}()
 
-		log.Println("[start] Everything is up. Ctrl+C to stop.")
+		logger.Info("everything is up, Ctrl+C to stop")
 
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 		<-quit
 
-		log.Println("\n[start] Shutting down...")
+		logger.Info("shutting down")
 
 		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
 		if err := server.Shutdown(shutCtx); err != nil {
-			log.Printf("[start] Forced shutdown: %v", err)
+			logger.Warn("forced shutdown", "error", err)
 		}
 
 		server.StopWatcher()
 
-		if withDocker {
-			log.Println("[start] Bringing Docker down...")
+		if withDocker && cfg.ManageDocker {
+			logger.Info("bringing docker down")
 			c := exec.Command("docker", "compose", "down")
 			c.Stdout = os.Stdout
 			c.Stderr = os.Stderr
 			c.Run()
 		}
 
-		log.Println("[start] Bye.")
+		logger.Info("bye")
 	},
 }
 
+func newSearchClient() (*search.Client, error) {
+	return search.New(search.Options{
+		Addresses:   cfg.ESURLs,
+		CloudID:     cfg.ESCloudID,
+		Username:    cfg.ESUsername,
+		Password:    cfg.ESPassword,
+		APIKey:      cfg.ESAPIKey,
+		CACertFile:  cfg.ESCACert,
+		Fingerprint: cfg.ESFingerprint,
+	}, logger)
+}
+
+func newPipeline() *preprocess.Pipeline {
+	return preprocess.New(preprocess.Options{
+		SplitSpreads:    cfg.SplitSpreads,
+		SpreadRatio:     cfg.SpreadRatio,
+		RightToLeft:     cfg.RightToLeft,
+		TrimBorders:     cfg.TrimBorders,
+		TrimTolerance:   uint8(cfg.TrimTolerance),
+		Grayscale:       cfg.Grayscale,
+		UpscaleMinWidth: cfg.UpscaleMinWidth,
+		Converter:       cfg.ImageConverter,
+	})
+}
+
+// checkImageConverter makes sure AVIF and JPEG XL pages can be decoded
+// before any are queued. Left at the default, IMAGE_FORMATS drops them when
+// the converter isn't installed; asked for by name, they are an error.
+func checkImageConverter() {
+	converted := imageformat.Converted(cfg.ImageFormats)
+	if len(converted) == 0 || imageformat.ConverterInstalled(cfg.ImageConverter) {
+		return
+	}
+	missing := errors.New("image converter not found on PATH")
+	if len(cfg.ImageConverter) > 0 {
+		missing = fmt.Errorf("image converter %q not found on PATH", cfg.ImageConverter[0])
+	}
+	if os.Getenv("IMAGE_FORMATS") != "" {
+		fatal("invalid config", fmt.Errorf("IMAGE_FORMATS includes %s: %w; install it, set IMAGE_CONVERTER, or leave those formats out", strings.Join(converted, ", "), missing))
+	}
+	logger.Warn("skipping pages that need an image converter", "formats", converted, "error", missing)
+	cfg.ImageFormats = slices.DeleteFunc(slices.Clone(cfg.ImageFormats), func(f string) bool {
+		return slices.Contains(converted, strings.ToLower(f))
+	})
+}
+
+func newResolver() *ocr.Resolver {
+	perLibrary := make(map[string]ocr.Settings)
+	for _, l := range cfg.EffectiveLibraries() {
+		perLibrary[l.Name] = ocr.Settings{Languages: l.OCRLanguages, Direction: l.OCRDirection}
+	}
+	perSeries := make(map[string]ocr.Settings, len(cfg.SeriesOCR))
+	for series, s := range cfg.SeriesOCR {
+		perSeries[series] = ocr.Settings{Languages: s.Languages, Direction: s.Direction}
+	}
+	return ocr.NewResolver(ocr.Settings{Languages: cfg.OCRLanguages, Direction: cfg.OCRDirection}, perLibrary, perSeries, logger)
+}
+
 func init() {
 	startCmd.Flags().BoolVar(&withDocker, "with-docker", false, "run docker compose down on exit")
+	startCmd.Flags().BoolVar(&noDocker, "no-docker", false, "don't run docker compose; use services that are already running (same as MANAGE_DOCKER=false)")
 }
@@ -1,41 +1,105 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
+type statusReport struct {
+	Indexed          int      `json:"indexed"`
+	Failed           int      `json:"failed"`
+	InQueue          int      `json:"in_queue"`
+	ThroughputPerMin float64  `json:"throughput_per_min"`
+	ETASeconds       *float64 `json:"eta_seconds"`
+	Workers          []struct {
+		ID             int      `json:"id"`
+		Paths          []string `json:"paths"`
+		ElapsedSeconds float64  `json:"elapsed_seconds"`
+	} `json:"workers"`
+	Series []struct {
+		Library    string `json:"library"`
+		Series     string `json:"series"`
+		Discovered int    `json:"discovered"`
+		Indexed    int    `json:"indexed"`
+		Failed     int    `json:"failed"`
+		Pending    int    `json:"pending"`
+	} `json:"series"`
+}
+
+var statusWatch time.Duration
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
-	Short: "Show indexed pages and queue length",
+	Short: "Show indexing progress per series and what the workers are doing",
+	Args:  cobra.NoArgs,
+	Example: `  mangasearch status
+  mangasearch status --watch 10s`,
 	Run: func(cmd *cobra.Command, args []string) {
-		apiURL := fmt.Sprintf("http://localhost:%d/status", cfg.APIPort)
+		apiURL := apiEndpoint("/status")
 
-		resp, err := http.Get(apiURL)
-		if err != nil {
-			log.Fatalf("❌  Can't reach the API server. Is mangasearch running? (%v)", err)
+		if statusWatch <= 0 {
+			var status statusReport
+			getJSON(apiURL, &status)
+			printStatus(status)
+			return
 		}
-		defer resp.Body.Close()
 
-		body, _ := io.ReadAll(resp.Body)
-
-		if resp.StatusCode != http.StatusOK {
-			log.Fatalf("❌  Status check failed: %s", string(body))
+		// In watch mode a failed poll is reported and retried, not fatal.
+		for {
+			var status statusReport
+			err := fetchJSON(apiURL, &status)
+			fmt.Print("\033[H\033[2J")
+			if err != nil {
+				fmt.Printf("❌  %v (retrying in %s)\n", err, statusWatch)
+			} else {
+				printStatus(status)
+			}
+			time.Sleep(statusWatch)
 		}
+	},
+}
 
-		var status map[string]interface{}
-		if err := json.Unmarshal(body, &status); err != nil {
-			log.Fatalf("❌  Bad response: %v", err)
+func init() {
+	statusCmd.Flags().DurationVarP(&statusWatch, "watch", "w", 0, "refresh every interval (e.g. 2s) until interrupted")
+}
+
+func printStatus(status statusReport) {
+	eta := "—"
+	if status.ETASeconds != nil {
+		eta = (time.Duration(*status.ETASeconds) * time.Second).String()
+	}
+
+	fmt.Println("\nMangaSearch Status:")
+	fmt.Println("─────────────────────")
+	fmt.Printf("  ✓  Indexed    : %d\n", status.Indexed)
+	fmt.Printf("  ✗  Failed     : %d\n", status.Failed)
+	fmt.Printf("  📥  In queue   : %d\n", status.InQueue)
+	fmt.Printf("  ⚡  Throughput : %.1f pages/min\n", status.ThroughputPerMin)
+	fmt.Printf("  ⏳  ETA        : %s\n", eta)
+	fmt.Println("─────────────────────")
+
+	if len(status.Series) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "LIBRARY\tSERIES\tDISCOVERED\tINDEXED\tFAILED\tPENDING")
+		for _, s := range status.Series {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", s.Library, s.Series, s.Discovered, s.Indexed, s.Failed, s.Pending)
 		}
+		w.Flush()
+		fmt.Println()
+	}
 
-		fmt.Println("\nMangaSearch Status:")
-		fmt.Println("─────────────────────")
-		fmt.Printf("  ✓  Indexed   : %v\n", status["indexed"])
-		fmt.Printf("  📥  In queue  : %v\n", status["in_queue"])
-		fmt.Println("─────────────────────")
-	},
+	if len(status.Workers) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WORKER\tBUSY FOR\tPAGES")
+		for _, wk := range status.Workers {
+			busy := time.Duration(wk.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+			fmt.Fprintf(w, "%d\t%s\t%s\n", wk.ID, busy, strings.Join(wk.Paths, ", "))
+		}
+		w.Flush()
+	}
 }
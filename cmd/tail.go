@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tailTypes []string
+
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Stream indexing events from a running server",
+	Example: `  mangasearch tail
+  mangasearch tail --type page.failed --type page.indexed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		apiURL := apiEndpoint("/events")
+
+		resp, err := apiGet(apiURL)
+		if err != nil {
+			log.Fatalf("❌  Can't reach the API server. Is mangasearch running? (%v)", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("❌  Request failed: %s", string(body))
+		}
+
+		wanted := make(map[string]bool, len(tailTypes))
+		for _, t := range tailTypes {
+			wanted[t] = true
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		var data strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "data:"):
+				data.WriteString(strings.TrimPrefix(line, "data:"))
+			case line == "" && data.Len() > 0:
+				var e tailEvent
+				if err := json.Unmarshal([]byte(data.String()), &e); err == nil && (len(wanted) == 0 || wanted[e.Type]) {
+					fmt.Println(e)
+				}
+				data.Reset()
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("❌  Stream closed: %v", err)
+		}
+		log.Println("Server closed the stream.")
+	},
+}
+
+type tailEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Path     string    `json:"path"`
+	PageID   int64     `json:"page_id"`
+	Worker   int       `json:"worker"`
+	Error    string    `json:"error"`
+	ToIndex  int       `json:"to_index"`
+	ToDelete int       `json:"to_delete"`
+	Done     int       `json:"done"`
+	Total    int       `json:"total"`
+}
+
+func (e tailEvent) String() string {
+	prefix := fmt.Sprintf("%s  %-16s", e.Time.Local().Format(time.TimeOnly), e.Type)
+	switch e.Type {
+	case "page.queued":
+		return fmt.Sprintf("%s %s", prefix, e.Path)
+	case "ocr.started":
+		return fmt.Sprintf("%s [worker %d] %s", prefix, e.Worker, e.Path)
+	case "page.indexed":
+		return fmt.Sprintf("%s [worker %d] %s (id %d)", prefix, e.Worker, e.Path, e.PageID)
+	case "page.failed":
+		return fmt.Sprintf("%s [worker %d] %s: %s", prefix, e.Worker, e.Path, e.Error)
+	case "scan.finished":
+		return fmt.Sprintf("%s %d to index, %d to delete", prefix, e.ToIndex, e.ToDelete)
+	case "rebuild.progress":
+		return fmt.Sprintf("%s %d/%d", prefix, e.Done, e.Total)
+	}
+	return prefix
+}
+
+func init() {
+	tailCmd.Flags().StringArrayVar(&tailTypes, "type", nil, "only show events of this type (repeatable)")
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) HandleListSeries(c *gin.Context) {
+	series, err := s.db.ListSeries(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+func (s *Server) HandleListChapters(c *gin.Context) {
+	chapters, err := s.db.ListChapters(context.Background(), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(chapters) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "series not found"})
+		return
+	}
+	c.JSON(http.StatusOK, chapters)
+}
+
+func (s *Server) HandleListPages(c *gin.Context) {
+	pages, err := s.db.ListPages(context.Background(), c.Param("name"), c.Param("chapter"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(pages) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chapter not found"})
+		return
+	}
+	c.JSON(http.StatusOK, pages)
+}
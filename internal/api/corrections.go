@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"mangasearch/internal/db"
+	"mangasearch/internal/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+type correctionRequest struct {
+	Text   string `json:"text"`
+	Author string `json:"author"`
+}
+
+// HandleCorrectPage stores a human correction in front of the OCR text and
+// reindexes the page right away.
+func (s *Server) HandleCorrectPage(c *gin.Context) {
+	page, ok := s.lookupPage(c)
+	if !ok {
+		return
+	}
+
+	var req correctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is empty; DELETE the correction instead"})
+		return
+	}
+
+	if err := s.db.SetCorrection(context.Background(), page.Path, req.Text, correctionAuthor(c, req.Author)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	page.Correction, page.Corrected = req.Text, true
+	s.reindexPage(c, page)
+}
+
+// HandleRevertPage drops the correction so the OCR text is searched again.
+func (s *Server) HandleRevertPage(c *gin.Context) {
+	page, ok := s.lookupPage(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.ClearCorrection(context.Background(), page.Path, correctionAuthor(c, c.Query("author"))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	page.Correction, page.Corrected = "", false
+	s.reindexPage(c, page)
+}
+
+func (s *Server) HandlePageHistory(c *gin.Context) {
+	page, ok := s.lookupPage(c)
+	if !ok {
+		return
+	}
+
+	history, err := s.db.CorrectionHistory(context.Background(), page.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// correctionAuthor names who made a change: the API key's name, or, with
+// auth off, whoever the client says it is.
+func correctionAuthor(c *gin.Context, claimed string) string {
+	if k, ok := requestAPIKey(c); ok {
+		return k.Name
+	}
+	return claimed
+}
+
+func (s *Server) reindexPage(c *gin.Context, page db.Page) {
+	if err := s.es.IndexPage(c.Request.Context(), search.DocumentFor(page)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "correction saved but reindex failed: " + err.Error()})
+		return
+	}
+	// Cached searches would keep showing the old text for their TTL.
+	s.redis.CacheClear()
+	c.JSON(http.StatusOK, gin.H{
+		"id":        page.ID,
+		"text":      page.EffectiveText(),
+		"corrected": page.Corrected,
+	})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mangasearch/internal/events"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const eventsKeepAlive = 15 * time.Second
+
+// HandleEvents streams indexing activity as server-sent events. Each event's
+// name is its type, e.g. "page.indexed", and its data the JSON event.
+func (s *Server) HandleEvents(c *gin.Context) {
+	ch, cancel := s.events.Subscribe(256)
+	defer cancel()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.Render(-1, sse.Event{Event: e.Type, Id: strconv.FormatUint(e.ID, 10), Data: e})
+			return true
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// trackRebuild reports rebuild.progress for every page finished until the
+// returned function is called. A negative total is taken from the next
+// scan.finished, and pages finished before it are not counted.
+func (s *Server) trackRebuild(total int) func() {
+	ch, cancel := s.events.Subscribe(1024)
+	if total >= 0 {
+		s.events.Publish(events.Event{Type: events.RebuildProgress, Done: 0, Total: total})
+	}
+	go func() {
+		done := 0
+		for e := range ch {
+			switch e.Type {
+			case events.ScanFinished:
+				if total < 0 {
+					total = e.ToIndex
+					s.events.Publish(events.Event{Type: events.RebuildProgress, Done: 0, Total: total})
+				}
+			case events.PageIndexed, events.PageFailed:
+				if total < 0 {
+					continue
+				}
+				done++
+				s.events.Publish(events.Event{Type: events.RebuildProgress, Done: done, Total: total})
+			}
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mangasearch/internal/config"
+	"mangasearch/internal/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bus := events.NewBus()
+	s := &Server{cfg: &config.Config{}, events: bus, router: gin.New()}
+	s.registerRoutes()
+
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// The handler subscribes once the headers are out, so an event published
+	// before that would be lost; keep publishing until one arrives.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bus.Publish(events.Event{Type: events.PageIndexed, PageID: 42})
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-stop:
+				return
+			}
+		}
+		close(lines)
+	}()
+
+	var event, data string
+	timeout := time.After(5 * time.Second)
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream ended before an event arrived")
+			}
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimPrefix(line, "data:")
+			}
+		case <-timeout:
+			t.Fatal("no event received")
+		}
+	}
+
+	if event != events.PageIndexed {
+		t.Errorf("event = %q, want %q", event, events.PageIndexed)
+	}
+	if !strings.Contains(data, `"type":"page.indexed"`) || !strings.Contains(data, `"page_id":42`) {
+		t.Errorf("data = %s", data)
+	}
+}
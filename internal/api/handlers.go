@@ -3,7 +3,16 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"mangasearch/internal/db"
+	"mangasearch/internal/metrics"
+	"mangasearch/internal/queue"
+	"mangasearch/internal/search"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,26 +24,57 @@ func (s *Server) HandleSearch(c *gin.Context) {
 		return
 	}
 
-	if cached, ok := s.redis.CacheGet(q); ok {
+	filters := search.Filters{
+		Library:  c.Query("library"),
+		Series:   c.Query("series"),
+		Chapter:  c.Query("chapter"),
+		Language: c.Query("language"),
+	}
+	cacheKey := url.Values{
+		"q":        {q},
+		"library":  {filters.Library},
+		"series":   {filters.Series},
+		"chapter":  {filters.Chapter},
+		"language": {filters.Language},
+	}.Encode()
+
+	if cached, ok := s.redis.CacheGet(cacheKey); ok {
 		c.Data(http.StatusOK, "application/json", []byte(cached))
 		return
 	}
 
-	results, err := s.es.Search(context.Background(), q)
+	began := time.Now()
+	results, err := s.es.Search(c.Request.Context(), q, filters)
+	metrics.SearchLatency.Observe(time.Since(began).Seconds())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	if encoded, err := json.Marshal(results); err == nil {
-		s.redis.CacheSet(q, string(encoded))
+		s.redis.CacheSet(cacheKey, string(encoded))
 	}
 
 	c.JSON(http.StatusOK, results)
 }
 
+type seriesProgress struct {
+	Library    string `json:"library"`
+	Series     string `json:"series"`
+	Discovered int    `json:"discovered"`
+	Indexed    int    `json:"indexed"`
+	Failed     int    `json:"failed"`
+	Pending    int    `json:"pending"`
+}
+
+type workerStatus struct {
+	queue.WorkerActivity
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
 func (s *Server) HandleStatus(c *gin.Context) {
-	count, err := s.db.CountPages(context.Background())
+	ctx := context.Background()
+	count, err := s.db.CountPages(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -46,14 +86,99 @@ func (s *Server) HandleStatus(c *gin.Context) {
 		return
 	}
 
+	summaries, err := s.db.ListSeries(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bySeries := make(map[queue.SeriesKey]*seriesProgress)
+	entry := func(key queue.SeriesKey) *seriesProgress {
+		if p, ok := bySeries[key]; ok {
+			return p
+		}
+		p := &seriesProgress{Library: key.Library, Series: key.Series}
+		bySeries[key] = p
+		return p
+	}
+	failed := 0
+	for _, summary := range summaries {
+		p := entry(queue.SeriesKey{Library: summary.Library, Series: summary.Series})
+		p.Indexed = summary.Pages
+		p.Failed = summary.Failed
+		failed += summary.Failed
+	}
+	for path := range s.files() {
+		if library, series, _, _, err := s.layouts.Parse(path); err == nil {
+			entry(queue.SeriesKey{Library: library, Series: series}).Discovered++
+		}
+	}
+	for key, n := range s.redis.Pending() {
+		entry(key).Pending = n
+	}
+
+	series := make([]seriesProgress, 0, len(bySeries))
+	for _, p := range bySeries {
+		series = append(series, *p)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Series != series[j].Series {
+			return series[i].Series < series[j].Series
+		}
+		return series[i].Library < series[j].Library
+	})
+
+	now := time.Now()
+	workers := []workerStatus{}
+	for _, activity := range s.redis.Workers() {
+		workers = append(workers, workerStatus{
+			WorkerActivity: activity,
+			ElapsedSeconds: now.Sub(activity.Since).Seconds(),
+		})
+	}
+
+	throughput := s.redis.Throughput()
+	var eta any
+	if throughput > 0 {
+		eta = math.Round(float64(queueLen) / throughput * 60)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"indexed":  count,
-		"in_queue": queueLen,
+		"indexed":            count,
+		"failed":             failed,
+		"in_queue":           queueLen,
+		"throughput_per_min": math.Round(throughput*10) / 10,
+		"eta_seconds":        eta,
+		"workers":            workers,
+		"series":             series,
+		"held_deletions":     s.HeldDeletions(),
 	})
 }
 
 func (s *Server) HandleRebuild(c *gin.Context) {
-	ctx := context.Background()
+	// The wipe must finish even if the client hangs up; the request ID
+	// still follows it into the logs.
+	ctx := context.WithoutCancel(c.Request.Context())
+	noCache := c.Query("no_cache") == "true"
+	discardCorrections := c.Query("discard_corrections") == "true"
+	scope := db.Scope{
+		Library: c.Query("library"),
+		Series:  c.Query("series"),
+		Chapter: c.Query("chapter"),
+		Prefix:  c.Query("prefix"),
+	}
+	if scope.Chapter != "" && scope.Series == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chapter needs a series"})
+		return
+	}
+	if scope.Library != "" && !s.hasLibrary(scope.Library) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown library " + scope.Library})
+		return
+	}
+	if !scope.IsZero() {
+		s.rebuildScope(c, scope, noCache, discardCorrections)
+		return
+	}
 
 	if err := s.db.DeleteAllPages(ctx); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "postgres wipe failed: " + err.Error()})
@@ -65,7 +190,14 @@ func (s *Server) HandleRebuild(c *gin.Context) {
 		return
 	}
 
-	pushed, err := s.RunScan()
+	if err := s.es.InitIndex(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "elasticsearch index init failed: " + err.Error()})
+		return
+	}
+
+	stopTracking := s.trackRebuild(-1)
+	pushed, err := s.runScan(noCache, discardCorrections)
+	stopTracking()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "watcher scan failed: " + err.Error()})
 		return
@@ -76,3 +208,73 @@ func (s *Server) HandleRebuild(c *gin.Context) {
 		"queued_jobs": pushed,
 	})
 }
+
+// rebuildScope wipes one library, series, chapter or path prefix and
+// re-queues the matching files the watchers last saw. The rest of the index is untouched.
+func (s *Server) rebuildScope(c *gin.Context, scope db.Scope, noCache, discardCorrections bool) {
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	deleted, err := s.db.DeletePages(ctx, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "postgres delete failed: " + err.Error()})
+		return
+	}
+
+	if err := s.es.DeletePages(ctx, scope.Library, scope.Series, scope.Chapter, scope.Prefix); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "elasticsearch delete failed: " + err.Error()})
+		return
+	}
+
+	var jobs []queue.Job
+	for path := range s.files() {
+		library, series, chapter, _, err := s.layouts.Parse(path)
+		if err == nil && scope.MatchesPage(path, library, series, chapter) {
+			jobs = append(jobs, queue.Job{Path: path, NoCache: noCache, DiscardCorrection: discardCorrections})
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Path < jobs[j].Path })
+
+	stopTracking := s.trackRebuild(len(jobs))
+	s.redis.StartJobs(jobs)
+	stopTracking()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "rebuild started",
+		"deleted_pages": deleted,
+		"queued_jobs":   len(jobs),
+	})
+}
+
+// HandleScanReport returns each library's last scan: folders and files
+// seen, how long it took, and what couldn't be read.
+func (s *Server) HandleScanReport(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"libraries": s.ScanReports()})
+}
+
+// HandleConfirmDeletions lets a scan held back for deleting too many pages
+// go ahead, and runs it.
+func (s *Server) HandleConfirmDeletions(c *gin.Context) {
+	library := c.Query("library")
+	if library != "" && !s.hasLibrary(library) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown library " + library})
+		return
+	}
+	pushed, err := s.ConfirmDeletions(library)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "watcher scan failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "deletions confirmed",
+		"queued_jobs": pushed,
+	})
+}
+
+func (s *Server) hasLibrary(name string) bool {
+	for _, lib := range s.layouts {
+		if lib.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"mangasearch/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleMetrics serves Prometheus metrics. Queue depth lives in Redis, so
+// it's read at scrape time rather than tracked as jobs move.
+func (s *Server) HandleMetrics(c *gin.Context) {
+	if s.redis != nil {
+		if n, err := s.redis.QueueLength(); err == nil {
+			metrics.QueueDepth.Set(float64(n))
+		}
+	}
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
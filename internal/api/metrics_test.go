@@ -0,0 +1,53 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mangasearch/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{cfg: &config.Config{}, router: gin.New()}
+	s.registerRoutes()
+	s.router.GET("/probe/:id", func(c *gin.Context) { c.Status(http.StatusTeapot) })
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	for _, id := range []string{"1", "2"} {
+		resp, err := http.Get(srv.URL + "/probe/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+	want := `mangasearch_http_requests_total{method="GET",route="/probe/:id",status="418"} 2`
+	if !strings.Contains(text, want) {
+		t.Errorf("metrics missing %q", want)
+	}
+	for _, name := range []string{"mangasearch_queue_depth", "mangasearch_search_cache_requests_total", "mangasearch_watcher_files_discovered"} {
+		if !strings.Contains(text, name) {
+			t.Errorf("metrics missing %s", name)
+		}
+	}
+}
@@ -1,20 +1,132 @@
 package api
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"mangasearch/internal/db"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/metrics"
 	"github.com/gin-gonic/gin"
 )
 
-func loggerMiddleware() gin.HandlerFunc {
+// KeyCookie carries the API key for browsers, whose image requests can't
+// set headers.
+const KeyCookie = "mangasearch_key"
+
+// apiKeyContext is the gin context key authMiddleware stores the request's
+// API key under.
+const apiKeyContext = "api_key"
+
+type keyLookup interface {
+	LookupAPIKey(ctx context.Context, key string) (db.APIKey, bool, error)
+}
+
+// RequestIDHeader carries the request ID back to the client. A caller that
+// already has one, such as a proxy, can send it and it is kept.
+const RequestIDHeader = "X-Request-ID"
+
+// loggerMiddleware gives every request an ID, attaches it to the request
+// context so anything logged while handling it carries the ID, and logs
+// the request once it's done.
+func loggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	logger = logging.OrDefault(logger)
 	return func(c *gin.Context) {
 		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		ctx := logging.With(c.Request.Context(), "request_id", id)
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
-		log.Printf("[API] %s %s → %d (%s)",
-			c.Request.Method,
-			c.Request.URL.Path,
-			c.Writer.Status(),
-			time.Since(start),
+		logger.InfoContext(ctx, "request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"took", time.Since(start),
+			"client", c.ClientIP(),
 		)
 	}
 }
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// metricsMiddleware records every request under its route pattern rather
+// than its path, so page IDs don't each get their own series.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPLatency.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// authMiddleware rejects requests without an active API key allowed to use
+// scope. With enabled false every request passes.
+func authMiddleware(keys keyLookup, enabled bool, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+		key := requestKey(c)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing API key"})
+			return
+		}
+		k, ok, err := keys.LookupAPIKey(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or revoked API key"})
+			return
+		}
+		if !k.Allows(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this key lacks the " + scope + " scope"})
+			return
+		}
+		c.Set(apiKeyContext, k)
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the key authMiddleware accepted, if auth is on.
+func requestAPIKey(c *gin.Context) (db.APIKey, bool) {
+	v, ok := c.Get(apiKeyContext)
+	if !ok {
+		return db.APIKey{}, false
+	}
+	k, ok := v.(db.APIKey)
+	return k, ok
+}
+
+func requestKey(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if key, err := c.Cookie(KeyCookie); err == nil {
+		return key
+	}
+	return ""
+}
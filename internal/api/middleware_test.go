@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mangasearch/internal/db"
+	"mangasearch/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeKeys map[string]db.APIKey
+
+func (f fakeKeys) LookupAPIKey(ctx context.Context, key string) (db.APIKey, bool, error) {
+	k, ok := f[key]
+	return k, ok, nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := fakeKeys{
+		"reader": {Scope: db.ScopeSearch},
+		"owner":  {Scope: db.ScopeAdmin},
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		scope   string
+		setup   func(r *http.Request)
+		want    int
+	}{
+		{"auth disabled", false, db.ScopeAdmin, func(r *http.Request) {}, http.StatusOK},
+		{"no key", true, db.ScopeSearch, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"unknown key", true, db.ScopeSearch, func(r *http.Request) { r.Header.Set("X-API-Key", "nope") }, http.StatusUnauthorized},
+		{"search key searches", true, db.ScopeSearch, func(r *http.Request) { r.Header.Set("Authorization", "Bearer reader") }, http.StatusOK},
+		{"search key can't rebuild", true, db.ScopeAdmin, func(r *http.Request) { r.Header.Set("Authorization", "Bearer reader") }, http.StatusForbidden},
+		{"admin key rebuilds", true, db.ScopeAdmin, func(r *http.Request) { r.Header.Set("X-API-Key", "owner") }, http.StatusOK},
+		{"admin key searches", true, db.ScopeSearch, func(r *http.Request) { r.Header.Set("X-API-Key", "owner") }, http.StatusOK},
+		{"cookie", true, db.ScopeSearch, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: KeyCookie, Value: "reader"}) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", authMiddleware(keys, tt.enabled, tt.scope), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(req)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorrectionAuthor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := fakeKeys{"owner": {Name: "alice", Scope: db.ScopeAdmin}}
+	for _, tt := range []struct {
+		name    string
+		enabled bool
+		want    string
+	}{
+		{"from the key", true, "alice"},
+		{"claimed with auth off", false, "mallory"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			r := gin.New()
+			r.PUT("/", authMiddleware(keys, tt.enabled, db.ScopeAdmin), func(c *gin.Context) {
+				got = correctionAuthor(c, "mallory")
+			})
+			req := httptest.NewRequest(http.MethodPut, "/", nil)
+			req.Header.Set("X-API-Key", "owner")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("author = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerMiddlewareRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(loggerMiddleware(logger))
+	r.GET("/ok", func(c *gin.Context) {
+		logger.InfoContext(c.Request.Context(), "inside handler")
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Fatal("no request ID in the response")
+	}
+	dec := json.NewDecoder(&buf)
+	for _, msg := range []string{"inside handler", "request"} {
+		var rec map[string]any
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["msg"] != msg || rec["request_id"] != id {
+			t.Errorf("log line %v, want msg %q with request_id %q", rec, msg, id)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(RequestIDHeader, "from-proxy")
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); got != "from-proxy" {
+		t.Errorf("request ID = %q, want the caller's from-proxy", got)
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mangasearch/internal/container"
+	"mangasearch/internal/db"
+	"mangasearch/internal/thumbnail"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errOutsideRoot = errors.New("path is outside the manga folder")
+
+func (s *Server) HandlePage(c *gin.Context) {
+	page, ok := s.lookupPage(c)
+	if !ok {
+		return
+	}
+
+	prev, next, err := s.db.PageNeighbors(context.Background(), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           page.ID,
+		"series":       page.Series,
+		"chapter":      page.Chapter,
+		"page":         page.Page,
+		"path":         page.Path,
+		"text":         page.EffectiveText(),
+		"machine_text": page.Text,
+		"corrected":    page.Corrected,
+		"language":     page.Language,
+		"blocks":       page.Blocks,
+		"prev_id":      prev,
+		"next_id":      next,
+		// The viewer swaps its arrow keys for right-to-left reading.
+		"right_to_left": s.cfg.RightToLeft,
+	})
+}
+
+func (s *Server) HandlePageImage(c *gin.Context) {
+	path, info, ok := s.pageFile(c)
+	if !ok {
+		return
+	}
+
+	f, err := container.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	c.Header("Cache-Control", "private, max-age=3600")
+	http.ServeContent(c.Writer, c.Request, filepath.Base(path), info.ModTime(), f)
+}
+
+func (s *Server) HandlePageThumb(c *gin.Context) {
+	path, info, ok := s.pageFile(c)
+	if !ok {
+		return
+	}
+
+	width := thumbnail.SnapWidth(c.Query("w"))
+	key := thumbnail.Key(path, info.ModTime(), width)
+	thumbPath, err := s.thumbs.Get(key, width, func() (io.ReadCloser, error) {
+		return container.Open(path)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	c.Header("ETag", `"`+key+`"`)
+	c.Header("Cache-Control", "private, max-age=86400")
+	http.ServeContent(c.Writer, c.Request, key+".jpg", info.ModTime(), f)
+}
+
+// pageFile looks up the page in the URL and checks its file is still on
+// disk inside its library's root. For a page inside a container the info is
+// the container's. It writes the error response itself.
+func (s *Server) pageFile(c *gin.Context) (string, os.FileInfo, bool) {
+	page, ok := s.lookupPage(c)
+	if !ok {
+		return "", nil, false
+	}
+
+	file, entry, inContainer := container.Split(page.Path)
+	if !inContainer {
+		file = page.Path
+	}
+	root := s.cfg.MangaFolder
+	for _, lib := range s.layouts {
+		if lib.Name == page.Library {
+			root = lib.Root
+		}
+	}
+	path, err := withinRoot(root, file)
+	if errors.Is(err, errOutsideRoot) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "page file not found: " + err.Error()})
+		return "", nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "page file not found: " + err.Error()})
+		return "", nil, false
+	}
+	if inContainer {
+		path = container.Join(path, entry)
+	}
+	return path, info, true
+}
+
+func (s *Server) lookupPage(c *gin.Context) (db.Page, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page id"})
+		return db.Page{}, false
+	}
+
+	page, found, err := s.db.GetPage(context.Background(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return db.Page{}, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "page not found"})
+		return db.Page{}, false
+	}
+	return page, true
+}
+
+// withinRoot resolves symlinks on both sides and returns the real path only
+// if it is inside root.
+func withinRoot(root, path string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return realPath, nil
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithinRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "manga")
+	page := filepath.Join(root, "Berserk", "Chapter_057", "014.jpg")
+	outside := filepath.Join(base, "secret.txt")
+	link := filepath.Join(root, "Berserk", "escape.jpg")
+
+	if err := os.MkdirAll(filepath.Dir(page), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{page, outside} {
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantOutside bool
+		wantErr     bool
+	}{
+		{name: "page inside root", path: page},
+		{name: "dot-dot escape", path: filepath.Join(root, "..", "secret.txt"), wantOutside: true, wantErr: true},
+		{name: "symlink escape", path: link, wantOutside: true, wantErr: true},
+		{name: "missing file", path: filepath.Join(root, "nope.jpg"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := withinRoot(root, tt.path)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("withinRoot(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantOutside != errors.Is(err, errOutsideRoot) {
+				t.Errorf("withinRoot(%q) error = %v, want errOutsideRoot %v", tt.path, err, tt.wantOutside)
+			}
+		})
+	}
+}
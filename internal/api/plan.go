@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"mangasearch/internal/layout"
+	"mangasearch/internal/natsort"
+	"mangasearch/internal/watcher"
+)
+
+// Plan compares every library against the database, as a scan does,
+// without queueing or deleting anything. held lists the libraries whose
+// deletions a real scan would hold back for confirmation.
+func (s *Server) Plan(ctx context.Context) (toIndex, toDelete []string, held []*watcher.TooManyDeletionsError, err error) {
+	for _, lib := range s.libraries {
+		index, del, err := lib.watcher.Compare(ctx, s.db)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("library %s: %w", lib.Name, err)
+		}
+		if tooMany := lib.watcher.Exceeds(len(del)); tooMany != nil {
+			held = append(held, tooMany)
+		}
+		toIndex = append(toIndex, index...)
+		toDelete = append(toDelete, del...)
+	}
+	return toIndex, toDelete, held, nil
+}
+
+// SeriesPages is one series' share of a list of pages. Series is empty for
+// paths the library layout can't parse.
+type SeriesPages struct {
+	Library string   `json:"library"`
+	Series  string   `json:"series"`
+	Paths   []string `json:"paths"`
+}
+
+// GroupBySeries sorts paths into their series, in library and series
+// order with each series' pages in reading order.
+func GroupBySeries(libs layout.Libraries, paths []string) []SeriesPages {
+	type key struct{ library, series string }
+	groups := make(map[key][]string)
+	for _, path := range paths {
+		library, series, _, _, err := libs.Parse(path)
+		if err != nil {
+			series = ""
+		}
+		k := key{library, series}
+		groups[k] = append(groups[k], path)
+	}
+	out := make([]SeriesPages, 0, len(groups))
+	for k, paths := range groups {
+		sort.Slice(paths, func(i, j int) bool { return natsort.Less(paths[i], paths[j]) })
+		out = append(out, SeriesPages{Library: k.library, Series: k.series, Paths: paths})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Library != out[j].Library {
+			return out[i].Library < out[j].Library
+		}
+		return natsort.Less(out[i].Series, out[j].Series)
+	})
+	return out
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"mangasearch/internal/layout"
+)
+
+func TestGroupBySeries(t *testing.T) {
+	libs := layout.Libraries{
+		{Name: "manga", Root: "/manga"},
+		{Name: "comics", Root: "/comics"},
+	}
+	got := GroupBySeries(libs, []string{
+		"/manga/Berserk/ch10/001.png",
+		"/manga/Vagabond/ch1/001.png",
+		"/manga/Berserk/ch9/001.png",
+		"/comics/Saga/Vol 1.cbz/01.jpg",
+		"/manga/stray.png",
+		"/elsewhere/Berserk/ch1/001.png",
+	})
+	want := []SeriesPages{
+		{Library: "", Series: "", Paths: []string{"/elsewhere/Berserk/ch1/001.png"}},
+		{Library: "comics", Series: "Saga", Paths: []string{"/comics/Saga/Vol 1.cbz/01.jpg"}},
+		{Library: "manga", Series: "", Paths: []string{"/manga/stray.png"}},
+		{Library: "manga", Series: "Berserk", Paths: []string{"/manga/Berserk/ch9/001.png", "/manga/Berserk/ch10/001.png"}},
+		{Library: "manga", Series: "Vagabond", Paths: []string{"/manga/Vagabond/ch1/001.png"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupBySeries =\n%+v\nwant\n%+v", got, want)
+	}
+}
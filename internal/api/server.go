@@ -2,28 +2,48 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"time"
 	"mangasearch/internal/config"
 	"mangasearch/internal/db"
+	"mangasearch/internal/events"
+	"mangasearch/internal/layout"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/metrics"
 	"mangasearch/internal/ocr"
 	"mangasearch/internal/queue"
 	"mangasearch/internal/search"
+	"mangasearch/internal/thumbnail"
 	"mangasearch/internal/watcher"
+	"mangasearch/internal/web"
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	cfg     *config.Config
-	db      *db.DB
-	es      *search.Client
-	ocr     *ocr.Client
-	redis   *queue.RedisQueue
-	watcher *watcher.Watcher
-	router  *gin.Engine
-	http    *http.Server
+	cfg       *config.Config
+	db        *db.DB
+	es        *search.Client
+	ocr       *ocr.Client
+	redis     *queue.RedisQueue
+	layouts   layout.Libraries
+	libraries []library
+	events    *events.Bus
+	thumbs    *thumbnail.Cache
+	router    *gin.Engine
+	http      *http.Server
+	log       *slog.Logger
+}
+
+// library is one configured library and the watcher that scans its root.
+type library struct {
+	layout.Library
+	watcher  *watcher.Watcher
+	interval time.Duration
 }
 
 func NewServer(
@@ -32,7 +52,9 @@ func NewServer(
 	es *search.Client,
 	ocr *ocr.Client,
 	redis *queue.RedisQueue,
-	watcher *watcher.Watcher,
+	libs layout.Libraries,
+	bus *events.Bus,
+	logger *slog.Logger,
 ) *Server {
 	s := &Server{
 		cfg:     cfg,
@@ -40,22 +62,79 @@ func NewServer(
 		es:      es,
 		ocr:     ocr,
 		redis:   redis,
-		watcher: watcher,
-		router:  gin.Default(),
+		layouts: libs,
+		events:  bus,
+		thumbs:  thumbnail.NewCache(cfg.ThumbnailDir, cfg.ImageConverter),
+		router:  gin.New(),
+		log:     logging.OrDefault(logger).With("component", "api"),
 	}
+	intervals := make(map[string]time.Duration)
+	for _, l := range cfg.EffectiveLibraries() {
+		intervals[l.Name] = l.WatchInterval
+	}
+	for _, lib := range libs {
+		interval := intervals[lib.Name]
+		if interval <= 0 {
+			interval = cfg.WatcherInterval
+		}
+		w := watcher.NewWatcher(lib.Root, WatcherOptions(cfg), logging.OrDefault(logger).With("library", lib.Name))
+		name := lib.Name
+		w.OnScan(func() {
+			bus.Publish(events.Event{Type: events.ScanStarted, Library: name})
+		})
+		w.OnError(func(err error) {
+			s.scanFailed(name, err)
+		})
+		s.libraries = append(s.libraries, library{Library: lib, watcher: w, interval: interval})
+	}
+	s.router.Use(gin.Recovery())
 	s.http = &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.APIPort),
+		Addr:    fmt.Sprintf("%s:%d", cfg.APIHost, cfg.APIPort),
 		Handler: s.router,
 	}
 	s.registerRoutes()
 	return s
 }
 
+// WatcherOptions are the scan settings every library's watcher shares.
+func WatcherOptions(cfg *config.Config) watcher.Options {
+	return watcher.Options{
+		Ignore:         cfg.Ignore,
+		Formats:        cfg.ImageFormats,
+		Parallelism:    cfg.ScanParallelism,
+		FollowSymlinks: cfg.FollowSymlinks,
+		MaxDeleteRatio: cfg.DeleteThreshold,
+	}
+}
+
 func (s *Server) registerRoutes() {
-	s.router.Use(loggerMiddleware())
-	s.router.GET("/search", s.HandleSearch)
-	s.router.GET("/status", s.HandleStatus)
-	s.router.POST("/rebuild", s.HandleRebuild)
+	s.router.Use(loggerMiddleware(s.log), metricsMiddleware())
+
+	read := s.router.Group("/", authMiddleware(s.db, s.cfg.APIAuth, db.ScopeSearch))
+	read.GET("/search", s.HandleSearch)
+	read.GET("/status", s.HandleStatus)
+	read.GET("/scan/report", s.HandleScanReport)
+	read.GET("/events", s.HandleEvents)
+	read.GET("/series", s.HandleListSeries)
+	read.GET("/series/:name/chapters", s.HandleListChapters)
+	read.GET("/series/:name/chapters/:chapter/pages", s.HandleListPages)
+	read.GET("/pages/:id", s.HandlePage)
+	read.GET("/pages/:id/image", s.HandlePageImage)
+	read.GET("/pages/:id/thumb", s.HandlePageThumb)
+	read.GET("/pages/:id/history", s.HandlePageHistory)
+	read.GET("/metrics", s.HandleMetrics)
+
+	admin := s.router.Group("/", authMiddleware(s.db, s.cfg.APIAuth, db.ScopeAdmin))
+	admin.POST("/rebuild", s.HandleRebuild)
+	admin.POST("/scan/confirm", s.HandleConfirmDeletions)
+	admin.PUT("/pages/:id/text", s.HandleCorrectPage)
+	admin.DELETE("/pages/:id/text", s.HandleRevertPage)
+
+	// The UI itself is public so it can ask for a key.
+	s.router.StaticFS("/ui", http.FS(web.Files()))
+	s.router.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/ui/")
+	})
 }
 
 func (s *Server) Run() error {
@@ -70,29 +149,144 @@ func (s *Server) Config() *config.Config {
 	return s.cfg
 }
 
+// StartWatcher rescans every library on its own interval.
 func (s *Server) StartWatcher() {
-	s.watcher.Start(context.Background(), s.db, s.cfg.WatcherInterval, func(toIndex, toDelete []string) {
-		for _, path := range toDelete {
-			s.db.DeletePage(context.Background(), path)
-		}
-		s.redis.Start(toIndex)
-	})
+	for _, lib := range s.libraries {
+		name := lib.Name
+		lib.watcher.Start(context.Background(), s.db, lib.interval, func(toIndex, toDelete []string) {
+			s.events.Publish(events.Event{Type: events.ScanFinished, Library: name, ToIndex: len(toIndex), ToDelete: len(toDelete)})
+			s.DeletePages(toDelete)
+			s.purgeDeleted()
+			metrics.FilesDiscovered.Set(float64(len(s.files())))
+			s.redis.Start(toIndex)
+		})
+	}
 }
 
 func (s *Server) StopWatcher() {
-	s.watcher.Stop()
+	for _, lib := range s.libraries {
+		lib.watcher.Stop()
+	}
+}
+
+// files is every page the watchers saw in their last scans.
+func (s *Server) files() map[string]time.Time {
+	files := make(map[string]time.Time)
+	for _, lib := range s.libraries {
+		for path, modTime := range lib.watcher.Files() {
+			files[path] = modTime
+		}
+	}
+	return files
 }
 
 func (s *Server) RunScan() (int, error) {
+	return s.runScan(false, false)
+}
+
+// runScan queues everything the watcher reports as new or changed. noCache
+// makes the workers re-OCR those pages instead of reusing cached results;
+// discardCorrections drops human corrections of the re-OCR'd pages. A
+// library that fails to scan doesn't stop the others.
+func (s *Server) runScan(noCache, discardCorrections bool) (int, error) {
 	count := 0
-	err := s.watcher.Scan(context.Background(), s.db, func(toIndex, toDelete []string) {
-		for _, path := range toDelete {
-			s.db.DeletePage(context.Background(), path)
+	var errs []error
+	for _, lib := range s.libraries {
+		err := lib.watcher.Scan(context.Background(), s.db, func(toIndex, toDelete []string) {
+			s.events.Publish(events.Event{Type: events.ScanFinished, Library: lib.Name, ToIndex: len(toIndex), ToDelete: len(toDelete)})
+			s.DeletePages(toDelete)
+			count += len(toIndex)
+			jobs := make([]queue.Job, 0, len(toIndex))
+			for _, path := range toIndex {
+				jobs = append(jobs, queue.Job{Path: path, NoCache: noCache, DiscardCorrection: discardCorrections})
+			}
+			s.redis.StartJobs(jobs)
+		})
+		if err != nil {
+			s.scanFailed(lib.Name, err)
+			errs = append(errs, fmt.Errorf("library %s: %w", lib.Name, err))
 		}
-		count = len(toIndex)
-		s.redis.Start(toIndex)
-	})
-	return count, err
+	}
+	s.purgeDeleted()
+	metrics.FilesDiscovered.Set(float64(len(s.files())))
+	return count, errors.Join(errs...)
+}
+
+func (s *Server) scanFailed(library string, err error) {
+	e := events.Event{Type: events.ScanFailed, Library: library, Error: err.Error()}
+	var tooMany *watcher.TooManyDeletionsError
+	if errors.As(err, &tooMany) {
+		e.ToDelete = tooMany.Deletions
+	}
+	s.events.Publish(e)
+}
+
+// ConfirmDeletions lets the next scan of library delete what it finds
+// missing even past the threshold, and runs that scan. An empty library
+// confirms them all.
+func (s *Server) ConfirmDeletions(library string) (int, error) {
+	for _, lib := range s.libraries {
+		if library == "" || lib.Name == library {
+			lib.watcher.ConfirmDeletions()
+		}
+	}
+	return s.RunScan()
+}
+
+// LibraryReport is the last scan report of one library.
+type LibraryReport struct {
+	Library string `json:"library"`
+	watcher.Report
+}
+
+// ScanReports returns the last scan report of every library.
+func (s *Server) ScanReports() []LibraryReport {
+	reports := make([]LibraryReport, 0, len(s.libraries))
+	for _, lib := range s.libraries {
+		reports = append(reports, LibraryReport{Library: lib.Name, Report: lib.watcher.Report()})
+	}
+	return reports
+}
+
+// HeldDeletions is, per library, how many deletions its last scan held
+// back for confirmation.
+func (s *Server) HeldDeletions() map[string]int {
+	held := make(map[string]int)
+	for _, lib := range s.libraries {
+		if n := lib.watcher.HeldDeletions(); n > 0 {
+			held[lib.Name] = n
+		}
+	}
+	return held
+}
+
+// DeletePages takes pages that are gone from disk out of the search index
+// and marks them deleted in Postgres. The rows are purged once
+// DeleteGracePeriod has passed, so a page whose file comes back keeps its
+// corrections.
+func (s *Server) DeletePages(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	ctx := context.Background()
+	if _, err := s.db.SoftDeletePages(ctx, paths); err != nil {
+		s.log.Error("could not delete pages", "pages", len(paths), "error", err)
+	}
+	if err := s.es.DeletePaths(ctx, paths); err != nil {
+		s.log.Error("could not delete pages from the index", "pages", len(paths), "error", err)
+	}
+}
+
+// purgeDeleted removes pages deleted longer ago than the grace period.
+func (s *Server) purgeDeleted() {
+	n, err := s.db.PurgeDeletedPages(context.Background(), time.Now().Add(-s.cfg.DeleteGracePeriod))
+	if err != nil {
+		s.log.Error("could not purge deleted pages", "error", err)
+		return
+	}
+	if n > 0 {
+		s.log.Info("purged deleted pages", "pages", n, "grace_period", s.cfg.DeleteGracePeriod)
+	}
 }
 
 func (s *Server) DockerDown() {
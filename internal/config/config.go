@@ -1,83 +1,424 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+	"mangasearch/internal/ignore"
+	"mangasearch/internal/imageformat"
+	"mangasearch/internal/layout"
 	"github.com/joho/godotenv"
 )
 
+type SeriesOCR struct {
+	Languages []string
+	Direction string
+}
+
+// Library is a named folder of manga with its own layout, OCR settings and
+// scan interval. Empty fields fall back to the global settings.
+type Library struct {
+	Name          string
+	Root          string
+	Layout        string
+	OCRLanguages  []string
+	OCRDirection  string
+	WatchInterval time.Duration
+}
+
 type Config struct {
+	// File is the config file the settings were read from, if any.
+	File                 string
 	MangaFolder          string
 	MangaFolderContainer string
+	// Libraries are the configured libraries; see EffectiveLibraries.
+	Libraries            []Library
+	Ignore               []string
+	ImageFormats         []string
+	ImageConverter       []string
+	PDFDPI               int
 	Workers              int
+	OCRBatchSize         int
+	OCRBatchWait         time.Duration
+	SplitSpreads         bool
+	SpreadRatio          float64
+	RightToLeft          bool
+	TrimBorders          bool
+	TrimTolerance        int
+	Grayscale            bool
+	UpscaleMinWidth      int
+	BlockProximity       float64
+	OCRLanguages         []string
+	OCRDirection         string
+	SeriesOCR            map[string]SeriesOCR
 	OCRPort              int
+	OCRURL               string
 	ESPort               int
+	ESURLs               []string
+	ESCloudID            string
+	ESUsername           string
+	ESPassword           string
+	ESAPIKey             string
+	ESCACert             string
+	ESFingerprint        string
 	APIPort              int
+	APIHost              string
+	APIAuth              bool
+	APIKey               string
+	// APIURL is where the CLI reaches the API server; APICACert is a PEM
+	// file for a private CA behind an https APIURL.
+	APIURL               string
+	APICACert            string
 	PostgresDSN          string
-	RedisAddr            string
+	RedisURL             string
+	RedisPassword        string
+	ManageDocker         bool
 	WatcherInterval      time.Duration
+	ScanParallelism      int
+	FollowSymlinks       bool
+	DeleteThreshold      float64
+	DeleteGracePeriod    time.Duration
+	ThumbnailDir         string
+	LogFormat            string
+	LogLevel             string
 }
 
-func Load(envPath string) (*Config, error) {
-	if err := godotenv.Load(envPath); err != nil {
+// Load reads settings from the environment, then envPath if it exists,
+// then the config file at configPath, or the first of SearchPaths when
+// configPath is empty. Earlier sources win.
+func Load(envPath, configPath string) (*Config, error) {
+	if err := godotenv.Load(envPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("config.Load: %w", err)
 	}
+	if configPath == "" {
+		configPath = os.Getenv("MANGASEARCH_CONFIG")
+	}
+	file, err := findConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		settings, err := readConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		applyConfigFile(settings)
+	}
 
-	cfg := &Config{}
+	cfg := &Config{File: file}
 	cfg.MangaFolder = os.Getenv("MANGA_FOLDER")
 	cfg.MangaFolderContainer = os.Getenv("MANGA_FOLDER_CONTAINER")
+	cfg.Libraries, err = parseLibraries("LIBRARIES")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MangaFolder == "" && len(cfg.Libraries) > 0 {
+		cfg.MangaFolder = cfg.Libraries[0].Root
+	}
+	cfg.Ignore = parseList("IGNORE", nil)
+	if _, err := ignore.Global("/", cfg.Ignore); err != nil {
+		return nil, fmt.Errorf("IGNORE invalid: %w", err)
+	}
+	cfg.ImageFormats = parseList("IMAGE_FORMATS", imageformat.Default)
+	if _, err := imageformat.NewSet(cfg.ImageFormats); err != nil {
+		return nil, fmt.Errorf("IMAGE_FORMATS invalid: %w", err)
+	}
+	cfg.ImageConverter = imageformat.DefaultConverter
+	if val := os.Getenv("IMAGE_CONVERTER"); val != "" {
+		cfg.ImageConverter = strings.Fields(val)
+	}
 	if cfg.MangaFolder == "" {
-		return nil, fmt.Errorf("MANGA_FOLDER is required in .env")
+		return nil, fmt.Errorf("MANGA_FOLDER is required: set manga_folder (or libraries) in the config file or MANGA_FOLDER in the environment")
 	}
 
-	var err error
 	cfg.Workers, err = parseInt("WORKERS", 1)
 	if err != nil {
 		return nil, err
 	}
 
+	cfg.OCRBatchSize, err = parseInt("OCR_BATCH_SIZE", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.OCRBatchWait, err = parseDuration("OCR_BATCH_WAIT", 500*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.SplitSpreads, err = parseBool("PREPROCESS_SPLIT_SPREADS", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.SpreadRatio, err = parseFloat("PREPROCESS_SPREAD_RATIO", 1.2)
+	if err != nil {
+		return nil, err
+	}
+
+	// PREPROCESS_RIGHT_TO_LEFT is the name this setting had before it also
+	// drove bubble ordering; older .env files still use it.
+	rtlKey := "RIGHT_TO_LEFT"
+	if os.Getenv(rtlKey) == "" && os.Getenv("PREPROCESS_RIGHT_TO_LEFT") != "" {
+		rtlKey = "PREPROCESS_RIGHT_TO_LEFT"
+	}
+	cfg.RightToLeft, err = parseBool(rtlKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.TrimBorders, err = parseBool("PREPROCESS_TRIM_BORDERS", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.TrimTolerance, err = parseInt("PREPROCESS_TRIM_TOLERANCE", 16)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TrimTolerance < 0 || cfg.TrimTolerance > 127 {
+		return nil, fmt.Errorf("PREPROCESS_TRIM_TOLERANCE must be between 0 and 127")
+	}
+
+	cfg.Grayscale, err = parseBool("PREPROCESS_GRAYSCALE", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.UpscaleMinWidth, err = parseInt("PREPROCESS_UPSCALE_MIN_WIDTH", 1200)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.BlockProximity, err = parseFloat("BLOCK_PROXIMITY", 1.0)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.OCRLanguages = parseList("OCR_LANGUAGES", []string{"en"})
+	cfg.OCRDirection = os.Getenv("OCR_DIRECTION")
+	if cfg.OCRDirection == "" {
+		cfg.OCRDirection = "horizontal"
+	}
+	if cfg.OCRDirection != "horizontal" && cfg.OCRDirection != "vertical" {
+		return nil, fmt.Errorf("OCR_DIRECTION must be horizontal or vertical")
+	}
+
+	cfg.SeriesOCR, err = parseSeriesOCR("SERIES_LANGUAGES")
+	if err != nil {
+		return nil, err
+	}
+
 	cfg.OCRPort, err = parseInt("OCR_PORT", 5001)
 	if err != nil {
 		return nil, err
 	}
 
+	cfg.OCRURL = os.Getenv("OCR_URL")
+	if cfg.OCRURL == "" {
+		cfg.OCRURL = fmt.Sprintf("http://%s:%d", getHost("OCR_HOST"), cfg.OCRPort)
+	}
+	if err := checkURL("OCR_URL", cfg.OCRURL, "http", "https"); err != nil {
+		return nil, err
+	}
+
 	cfg.ESPort, err = parseInt("ES_PORT", 9200)
 	if err != nil {
 		return nil, err
 	}
+	cfg.ESCloudID = os.Getenv("ES_CLOUD_ID")
+	cfg.ESURLs = parseList("ES_URL", nil)
+	if len(cfg.ESURLs) > 0 && cfg.ESCloudID != "" {
+		return nil, fmt.Errorf("set ES_URL or ES_CLOUD_ID, not both")
+	}
+	if len(cfg.ESURLs) == 0 && cfg.ESCloudID == "" {
+		cfg.ESURLs = []string{fmt.Sprintf("http://%s:%d", getHost("ES_HOST"), cfg.ESPort)}
+	}
+	for _, u := range cfg.ESURLs {
+		if err := checkURL("ES_URL", u, "http", "https"); err != nil {
+			return nil, err
+		}
+	}
+	cfg.ESUsername = os.Getenv("ES_USERNAME")
+	cfg.ESPassword = os.Getenv("ES_PASSWORD")
+	cfg.ESAPIKey = os.Getenv("ES_API_KEY")
+	cfg.ESCACert = os.Getenv("ES_CA_CERT")
+	cfg.ESFingerprint = os.Getenv("ES_CERT_FINGERPRINT")
 
 	cfg.APIPort, err = parseInt("API_PORT", 8080)
 	if err != nil {
 		return nil, err
 	}
 
-	postgresPort, err := parseInt("POSTGRES_PORT", 5432)
+	cfg.APIHost = os.Getenv("API_HOST")
+
+	cfg.APIAuth, err = parseBool("API_AUTH", true)
 	if err != nil {
 		return nil, err
 	}
-	cfg.PostgresDSN = fmt.Sprintf("postgres://%s:%s@localhost:%d/%s?sslmode=disable",
-		os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"),
-		postgresPort,
-		os.Getenv("POSTGRES_DB"),
-	)
 
-	redisPort, err := parseInt("REDIS_PORT", 6379)
+	cfg.APIKey = os.Getenv("API_KEY")
+
+	cfg.APIURL = os.Getenv("API_URL")
+	if cfg.APIURL == "" {
+		cfg.APIURL = fmt.Sprintf("http://localhost:%d", cfg.APIPort)
+	}
+	if err := checkURL("API_URL", cfg.APIURL, "http", "https"); err != nil {
+		return nil, err
+	}
+	cfg.APICACert = os.Getenv("API_CA_CERT")
+
+	// POSTGRES_DSN takes anything lib/pq does, URL or key=value, so TLS
+	// is set with its sslmode, sslrootcert, sslcert and sslkey options.
+	cfg.PostgresDSN = os.Getenv("POSTGRES_DSN")
+	if cfg.PostgresDSN == "" {
+		postgresPort, err := parseInt("POSTGRES_PORT", 5432)
+		if err != nil {
+			return nil, err
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD")),
+			Host:     fmt.Sprintf("%s:%d", getHost("POSTGRES_HOST"), postgresPort),
+			Path:     "/" + os.Getenv("POSTGRES_DB"),
+			RawQuery: "sslmode=disable",
+		}
+		cfg.PostgresDSN = dsn.String()
+	}
+
+	cfg.RedisURL = os.Getenv("REDIS_URL")
+	if cfg.RedisURL == "" {
+		redisPort, err := parseInt("REDIS_PORT", 6379)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RedisURL = fmt.Sprintf("redis://%s:%d/0", getHost("REDIS_HOST"), redisPort)
+	}
+	if err := checkURL("REDIS_URL", cfg.RedisURL, "redis", "rediss", "unix"); err != nil {
+		return nil, err
+	}
+	cfg.RedisPassword = os.Getenv("REDIS_PASSWORD")
+
+	cfg.ManageDocker, err = parseBool("MANAGE_DOCKER", true)
 	if err != nil {
 		return nil, err
 	}
-	cfg.RedisAddr = fmt.Sprintf("localhost:%d", redisPort)
 
 	cfg.WatcherInterval, err = parseDuration("WATCHER_INTERVAL", 30*time.Minute)
 	if err != nil {
 		return nil, err
 	}
 
+	cfg.PDFDPI, err = parseInt("PDF_DPI", 150)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ScanParallelism, err = parseInt("SCAN_PARALLELISM", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.FollowSymlinks, err = parseBool("FOLLOW_SYMLINKS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.DeleteThreshold, err = parseFloat("DELETE_THRESHOLD", 0.2)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.DeleteGracePeriod, err = parseDuration("DELETE_GRACE_PERIOD", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ThumbnailDir = os.Getenv("THUMBNAIL_DIR")
+	if cfg.ThumbnailDir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			cacheDir = os.TempDir()
+		}
+		cfg.ThumbnailDir = filepath.Join(cacheDir, "mangasearch", "thumbnails")
+	}
+
+	cfg.LogFormat = os.Getenv("LOG_FORMAT")
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "text"
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("LOG_FORMAT must be text or json")
+	}
+	cfg.LogLevel = strings.ToLower(os.Getenv("LOG_LEVEL"))
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+	}
+	switch cfg.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return nil, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+
 	return cfg, nil
 }
 
+// EffectiveLibraries is the configured libraries, or a single library named
+// layout.DefaultLibrary at MANGA_FOLDER when there are none.
+func (c *Config) EffectiveLibraries() []Library {
+	if len(c.Libraries) > 0 {
+		return c.Libraries
+	}
+	return []Library{{Name: layout.DefaultLibrary, Root: c.MangaFolder}}
+}
+
+// Layouts is EffectiveLibraries compiled for parsing page paths.
+func (c *Config) Layouts() (layout.Libraries, error) {
+	var libs layout.Libraries
+	for _, l := range c.EffectiveLibraries() {
+		lib := layout.Library{Name: l.Name, Root: l.Root}
+		if l.Layout != "" {
+			t, err := layout.Compile(l.Layout)
+			if err != nil {
+				return nil, fmt.Errorf("library %s: %w", l.Name, err)
+			}
+			lib.Layout = t
+		}
+		libs = append(libs, lib)
+	}
+	return libs, nil
+}
+
+// checkURL makes sure a service URL parses and uses one of schemes.
+func checkURL(key, raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s invalid: %w", key, err)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %q must start with %s://", key, u.Redacted(), strings.Join(schemes, ":// or "))
+}
+
+// getHost reads a service host, defaulting to this machine where docker
+// compose publishes the ports.
+func getHost(key string) string {
+	if host := os.Getenv(key); host != "" {
+		return host
+	}
+	return "localhost"
+}
+
 func parseInt(key string, defaultVal int) (int, error) {
 	val := os.Getenv(key)
 	if val == "" {
@@ -90,6 +431,134 @@ func parseInt(key string, defaultVal int) (int, error) {
 	return n, nil
 }
 
+func parseBool(key string, defaultVal bool) (bool, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%s invalid: %w", key, err)
+	}
+	return b, nil
+}
+
+func parseFloat(key string, defaultVal float64) (float64, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s invalid: %w", key, err)
+	}
+	return f, nil
+}
+
+func parseList(key string, defaultVal []string) []string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	var out []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseSeriesOCR reads "Vagabond=ja+en/vertical;Berserk=en". The direction
+// suffix is optional and falls back to OCR_DIRECTION.
+func parseSeriesOCR(key string) (map[string]SeriesOCR, error) {
+	out := make(map[string]SeriesOCR)
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		series, spec, ok := strings.Cut(entry, "=")
+		series = strings.TrimSpace(series)
+		if !ok || series == "" || strings.TrimSpace(spec) == "" {
+			return nil, fmt.Errorf("%s invalid entry %q, want series=lang[+lang][/direction]", key, entry)
+		}
+		langs, direction, _ := strings.Cut(spec, "/")
+		s := SeriesOCR{Direction: strings.TrimSpace(direction)}
+		for _, lang := range strings.Split(langs, "+") {
+			if lang = strings.TrimSpace(lang); lang != "" {
+				s.Languages = append(s.Languages, lang)
+			}
+		}
+		if s.Direction != "" && s.Direction != "horizontal" && s.Direction != "vertical" {
+			return nil, fmt.Errorf("%s invalid direction %q for %s", key, s.Direction, series)
+		}
+		out[series] = s
+	}
+	return out, nil
+}
+
+// parseLibraries reads a JSON list such as
+// [{"name": "manga", "root": "/media/manga", "layout": "{series}/{chapter}/{page}",
+// "ocr_languages": ["ja"], "ocr_direction": "vertical", "watch_interval": "10m"}].
+func parseLibraries(key string) ([]Library, error) {
+	val := os.Getenv(key)
+	if strings.TrimSpace(val) == "" {
+		return nil, nil
+	}
+	var raw []struct {
+		Name          string   `json:"name"`
+		Root          string   `json:"root"`
+		Layout        string   `json:"layout"`
+		OCRLanguages  []string `json:"ocr_languages"`
+		OCRDirection  string   `json:"ocr_direction"`
+		WatchInterval string   `json:"watch_interval"`
+	}
+	dec := json.NewDecoder(strings.NewReader(val))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s invalid: %w", key, err)
+	}
+	seen := make(map[string]bool)
+	libraries := make([]Library, 0, len(raw))
+	for i, r := range raw {
+		if r.Name == "" {
+			return nil, fmt.Errorf("%s: library %d has no name", key, i+1)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("%s: library %s is defined twice", key, r.Name)
+		}
+		seen[r.Name] = true
+		if r.Root == "" {
+			return nil, fmt.Errorf("%s: library %s has no root", key, r.Name)
+		}
+		if r.Layout != "" {
+			if _, err := layout.Compile(r.Layout); err != nil {
+				return nil, fmt.Errorf("%s: library %s: %w", key, r.Name, err)
+			}
+		}
+		if r.OCRDirection != "" && r.OCRDirection != "horizontal" && r.OCRDirection != "vertical" {
+			return nil, fmt.Errorf("%s: library %s ocr_direction must be horizontal or vertical", key, r.Name)
+		}
+		l := Library{
+			Name:         r.Name,
+			Root:         filepath.Clean(r.Root),
+			Layout:       r.Layout,
+			OCRLanguages: r.OCRLanguages,
+			OCRDirection: r.OCRDirection,
+		}
+		if r.WatchInterval != "" {
+			d, err := time.ParseDuration(r.WatchInterval)
+			if err != nil {
+				return nil, fmt.Errorf("%s: library %s watch_interval invalid: %w", key, r.Name, err)
+			}
+			l.WatchInterval = d
+		}
+		libraries = append(libraries, l)
+	}
+	return libraries, nil
+}
+
 func parseDuration(key string, defaultVal time.Duration) (time.Duration, error) {
 	val := os.Getenv(key)
 	if val == "" {
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// settingKeys are the environment variables Load reads. A config file
+// sets the same settings under the same names, lowercased, either flat
+// (postgres_dsn) or nested (postgres: {dsn: ...}).
+var settingKeys = []string{
+	"MANGA_FOLDER", "MANGA_FOLDER_CONTAINER", "LIBRARIES", "IGNORE",
+	"IMAGE_FORMATS", "IMAGE_CONVERTER", "PDF_DPI",
+	"WORKERS", "OCR_BATCH_SIZE", "OCR_BATCH_WAIT",
+	"PREPROCESS_SPLIT_SPREADS", "PREPROCESS_SPREAD_RATIO", "PREPROCESS_RIGHT_TO_LEFT",
+	"PREPROCESS_TRIM_BORDERS", "PREPROCESS_TRIM_TOLERANCE", "PREPROCESS_GRAYSCALE",
+	"PREPROCESS_UPSCALE_MIN_WIDTH",
+	"RIGHT_TO_LEFT", "BLOCK_PROXIMITY",
+	"OCR_LANGUAGES", "OCR_DIRECTION", "SERIES_LANGUAGES",
+	"OCR_HOST", "OCR_PORT", "OCR_URL",
+	"ES_HOST", "ES_PORT", "ES_URL", "ES_CLOUD_ID", "ES_USERNAME", "ES_PASSWORD",
+	"ES_API_KEY", "ES_CA_CERT", "ES_CERT_FINGERPRINT",
+	"API_HOST", "API_PORT", "API_AUTH", "API_KEY", "API_URL", "API_CA_CERT",
+	"POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB", "POSTGRES_DSN",
+	"REDIS_HOST", "REDIS_PORT", "REDIS_URL", "REDIS_PASSWORD",
+	"MANAGE_DOCKER", "WATCHER_INTERVAL", "SCAN_PARALLELISM", "FOLLOW_SYMLINKS",
+	"DELETE_THRESHOLD", "DELETE_GRACE_PERIOD", "THUMBNAIL_DIR",
+	"LOG_FORMAT", "LOG_LEVEL",
+}
+
+// SearchPaths lists where Load looks for a config file when it isn't
+// given one, in order.
+func SearchPaths() []string {
+	var paths []string
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		dir := filepath.Join(configHome, "mangasearch")
+		paths = append(paths, filepath.Join(dir, "config.yaml"), filepath.Join(dir, "config.toml"))
+	}
+	return append(paths, "/etc/mangasearch/config.yaml", "/etc/mangasearch/config.toml")
+}
+
+// findConfigFile returns path if set, otherwise the first search path that
+// exists, or "" when there is none.
+func findConfigFile(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file: %w", err)
+		}
+		return path, nil
+	}
+	for _, candidate := range SearchPaths() {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("config file: %w", err)
+		}
+	}
+	return "", nil
+}
+
+// readConfigFile decodes a YAML or TOML file into settings keyed by their
+// environment variable names.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("%s: config files must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	known := make(map[string]bool, len(settingKeys))
+	for _, key := range settingKeys {
+		known[key] = true
+	}
+	settings := make(map[string]string)
+	if err := flatten("", "", raw, known, settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// flatten walks nested tables, joining names with underscores until they
+// spell a known setting. name is the dotted path, for error messages.
+func flatten(prefix, name string, value any, known map[string]bool, out map[string]string) error {
+	table, isTable := value.(map[string]any)
+	if prefix != "" && known[prefix] {
+		if isTable && prefix == "SERIES_LANGUAGES" {
+			return flattenSeries(name, table, out)
+		}
+		if list, ok := value.([]any); ok && prefix == "LIBRARIES" {
+			return flattenLibraries(list, out)
+		}
+		s, err := scalar(name, value)
+		if err != nil {
+			return err
+		}
+		out[prefix] = s
+		return nil
+	}
+	if !isTable {
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	for key, child := range table {
+		childKey := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		childName := key
+		if prefix != "" {
+			childKey = prefix + "_" + childKey
+			childName = name + "." + key
+		}
+		if err := flatten(childKey, childName, child, known, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenSeries turns {Vagabond: ja+en/vertical} into the
+// SERIES_LANGUAGES form "Vagabond=ja+en/vertical".
+func flattenSeries(name string, table map[string]any, out map[string]string) error {
+	series := make([]string, 0, len(table))
+	for s := range table {
+		series = append(series, s)
+	}
+	sort.Strings(series)
+	entries := make([]string, 0, len(series))
+	for _, s := range series {
+		spec, err := scalar(name+"."+s, table[s])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, s+"="+spec)
+	}
+	out["SERIES_LANGUAGES"] = strings.Join(entries, ";")
+	return nil
+}
+
+// flattenLibraries stores the libraries list as the JSON LIBRARIES takes.
+func flattenLibraries(list []any, out map[string]string) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("libraries: %w", err)
+	}
+	out["LIBRARIES"] = string(data)
+	return nil
+}
+
+func scalar(name string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(name, item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", fmt.Errorf("%s must be a single value, not a table", name)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// applyConfigFile sets every setting from the file that the environment
+// (or .env) doesn't already set, so the environment always wins.
+func applyConfigFile(settings map[string]string) {
+	for key, val := range settings {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, val)
+		}
+	}
+}
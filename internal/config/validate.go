@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate checks what Load can't see from the values alone: that paths
+// exist and numbers are in range. It reports every problem at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if len(c.Libraries) == 0 {
+		if info, err := os.Stat(c.MangaFolder); err != nil {
+			errs = append(errs, fmt.Errorf("manga_folder %s: %w", c.MangaFolder, err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("manga_folder %s is not a folder", c.MangaFolder))
+		}
+	}
+	for i, l := range c.Libraries {
+		if info, err := os.Stat(l.Root); err != nil {
+			errs = append(errs, fmt.Errorf("library %s root: %w", l.Name, err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("library %s root %s is not a folder", l.Name, l.Root))
+		}
+		if l.WatchInterval < 0 {
+			errs = append(errs, fmt.Errorf("library %s watch_interval must be positive, got %s", l.Name, l.WatchInterval))
+		}
+		// a page under two roots would be scanned, and deleted, twice
+		for _, other := range c.Libraries[:i] {
+			if within(l.Root, other.Root) || within(other.Root, l.Root) {
+				errs = append(errs, fmt.Errorf("libraries %s and %s overlap: %s and %s", other.Name, l.Name, other.Root, l.Root))
+			}
+		}
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("workers must be at least 1, got %d", c.Workers))
+	}
+	if c.OCRBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("ocr_batch_size must be at least 1, got %d", c.OCRBatchSize))
+	}
+	if c.APIPort < 1 || c.APIPort > 65535 {
+		errs = append(errs, fmt.Errorf("api_port must be between 1 and 65535, got %d", c.APIPort))
+	}
+	if c.WatcherInterval <= 0 {
+		errs = append(errs, fmt.Errorf("watcher_interval must be positive, got %s", c.WatcherInterval))
+	}
+	if c.PDFDPI < 1 {
+		errs = append(errs, fmt.Errorf("pdf_dpi must be at least 1, got %d", c.PDFDPI))
+	}
+	if c.ScanParallelism < 1 {
+		errs = append(errs, fmt.Errorf("scan_parallelism must be at least 1, got %d", c.ScanParallelism))
+	}
+	if c.DeleteThreshold < 0 || c.DeleteThreshold > 1 {
+		errs = append(errs, fmt.Errorf("delete_threshold must be between 0 and 1, got %g", c.DeleteThreshold))
+	}
+	if c.DeleteGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("delete_grace_period must not be negative, got %s", c.DeleteGracePeriod))
+	}
+	if c.ESCACert != "" {
+		if _, err := os.Stat(c.ESCACert); err != nil {
+			errs = append(errs, fmt.Errorf("es_ca_cert: %w", err))
+		}
+	}
+	if c.APICACert != "" {
+		if _, err := os.Stat(c.APICACert); err != nil {
+			errs = append(errs, fmt.Errorf("api_ca_cert: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// within reports whether path is root or lies under it.
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Setting is one resolved value as `config show` prints it.
+type Setting struct {
+	Key   string
+	Value string
+}
+
+// Settings lists the resolved configuration under config file names, with
+// passwords and keys masked.
+func (c *Config) Settings() []Setting {
+	series := make([]string, 0, len(c.SeriesOCR))
+	for name, s := range c.SeriesOCR {
+		spec := strings.Join(s.Languages, "+")
+		if s.Direction != "" {
+			spec += "/" + s.Direction
+		}
+		series = append(series, name+"="+spec)
+	}
+	sort.Strings(series)
+	settings := []Setting{
+		{"manga_folder", c.MangaFolder},
+		{"manga_folder_container", c.MangaFolderContainer},
+		{"ignore", strings.Join(c.Ignore, ",")},
+		{"image_formats", strings.Join(c.ImageFormats, ",")},
+		{"image_converter", strings.Join(c.ImageConverter, " ")},
+		{"pdf_dpi", fmt.Sprint(c.PDFDPI)},
+		{"workers", fmt.Sprint(c.Workers)},
+		{"ocr_batch_size", fmt.Sprint(c.OCRBatchSize)},
+		{"ocr_batch_wait", c.OCRBatchWait.String()},
+		{"preprocess_split_spreads", fmt.Sprint(c.SplitSpreads)},
+		{"preprocess_spread_ratio", fmt.Sprint(c.SpreadRatio)},
+		{"preprocess_trim_borders", fmt.Sprint(c.TrimBorders)},
+		{"preprocess_trim_tolerance", fmt.Sprint(c.TrimTolerance)},
+		{"preprocess_grayscale", fmt.Sprint(c.Grayscale)},
+		{"preprocess_upscale_min_width", fmt.Sprint(c.UpscaleMinWidth)},
+		{"right_to_left", fmt.Sprint(c.RightToLeft)},
+		{"block_proximity", fmt.Sprint(c.BlockProximity)},
+		{"ocr_languages", strings.Join(c.OCRLanguages, ",")},
+		{"ocr_direction", c.OCRDirection},
+		{"series_languages", strings.Join(series, ";")},
+		{"ocr_url", redactURL(c.OCRURL)},
+		{"es_url", strings.Join(c.ESURLs, ",")},
+		{"es_cloud_id", c.ESCloudID},
+		{"es_username", c.ESUsername},
+		{"es_password", mask(c.ESPassword)},
+		{"es_api_key", mask(c.ESAPIKey)},
+		{"es_ca_cert", c.ESCACert},
+		{"es_cert_fingerprint", c.ESFingerprint},
+		{"api_host", c.APIHost},
+		{"api_port", fmt.Sprint(c.APIPort)},
+		{"api_auth", fmt.Sprint(c.APIAuth)},
+		{"api_key", mask(c.APIKey)},
+		{"api_url", redactURL(c.APIURL)},
+		{"api_ca_cert", c.APICACert},
+		{"postgres_dsn", redactDSN(c.PostgresDSN)},
+		{"redis_url", redactURL(c.RedisURL)},
+		{"redis_password", mask(c.RedisPassword)},
+		{"manage_docker", fmt.Sprint(c.ManageDocker)},
+		{"watcher_interval", c.WatcherInterval.String()},
+		{"scan_parallelism", fmt.Sprint(c.ScanParallelism)},
+		{"follow_symlinks", fmt.Sprint(c.FollowSymlinks)},
+		{"delete_threshold", fmt.Sprint(c.DeleteThreshold)},
+		{"delete_grace_period", c.DeleteGracePeriod.String()},
+		{"thumbnail_dir", c.ThumbnailDir},
+		{"log_format", c.LogFormat},
+		{"log_level", c.LogLevel},
+	}
+	for _, l := range c.Libraries {
+		spec := []string{"root=" + l.Root}
+		if l.Layout != "" {
+			spec = append(spec, "layout="+l.Layout)
+		}
+		if len(l.OCRLanguages) > 0 {
+			spec = append(spec, "ocr_languages="+strings.Join(l.OCRLanguages, ","))
+		}
+		if l.OCRDirection != "" {
+			spec = append(spec, "ocr_direction="+l.OCRDirection)
+		}
+		if l.WatchInterval > 0 {
+			spec = append(spec, "watch_interval="+l.WatchInterval.String())
+		}
+		settings = append(settings, Setting{"libraries." + l.Name, strings.Join(spec, " ")})
+	}
+	return settings
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "xxxxx"
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+var dsnPassword = regexp.MustCompile(`password=('[^']*'|\S*)`)
+
+// redactDSN masks the password of a URL or key=value DSN.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		return redactURL(dsn)
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password=xxxxx")
+}
@@ -0,0 +1,192 @@
+package container
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mangasearch/internal/natsort"
+)
+
+// A page inside a container is addressed by a virtual path: the container
+// file followed by the entry name, as if the container were a directory,
+// e.g. /manga/Berserk/Vol 01.cbz/012.png. PDF and EPUB pages are numbered
+// from 1 instead, e.g. /manga/Berserk/Vol 01.pdf/12.
+
+var containerExts = map[string]bool{
+	".cbz":  true,
+	".zip":  true,
+	".pdf":  true,
+	".epub": true,
+}
+
+// IsContainer reports whether name is a file whose pages are indexed
+// individually.
+func IsContainer(name string) bool {
+	return containerExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// Paged reports whether the pages of container name are addressed by page
+// number rather than entry name.
+func Paged(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".pdf" || ext == ".epub"
+}
+
+// Split breaks a virtual path into its container file and entry name. ok is
+// false for plain files.
+func Split(p string) (file, entry string, ok bool) {
+	slashed := filepath.ToSlash(p)
+	offset := 0
+	for {
+		i := strings.IndexByte(slashed[offset:], '/')
+		if i < 0 {
+			return "", "", false
+		}
+		end := offset + i
+		if end > 0 && IsContainer(slashed[:end]) {
+			return filepath.FromSlash(slashed[:end]), slashed[end+1:], true
+		}
+		offset = end + 1
+	}
+}
+
+// Join builds the virtual path of entry inside file.
+func Join(file, entry string) string {
+	return file + "/" + entry
+}
+
+// List returns the entries of file that keep accepts, in reading order.
+// Every page of a PDF is kept.
+func List(file string, keep func(name string) bool) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".pdf":
+		return listPDF(file)
+	case ".epub":
+		return listEPUB(file, keep)
+	}
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("container list %s: %w", file, err)
+	}
+	defer r.Close()
+
+	var entries []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !keep(path.Base(f.Name)) {
+			continue
+		}
+		entries = append(entries, f.Name)
+	}
+	sort.Slice(entries, func(i, j int) bool { return natsort.Less(entries[i], entries[j]) })
+	return entries, nil
+}
+
+func listPDF(file string) ([]string, error) {
+	n, err := pdfPages(file)
+	if err != nil {
+		return nil, fmt.Errorf("container list %s: %w", file, err)
+	}
+	return numbered(n, nil), nil
+}
+
+func listEPUB(file string, keep func(name string) bool) ([]string, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("container list %s: %w", file, err)
+	}
+	defer r.Close()
+	images, err := epubImages(&r.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("container list %s: %w", file, err)
+	}
+	return numbered(len(images), func(i int) bool { return keep(path.Base(images[i])) }), nil
+}
+
+// numbered names pages 1 to n, leaving out those keep rejects.
+func numbered(n int, keep func(i int) bool) []string {
+	entries := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if keep == nil || keep(i) {
+			entries = append(entries, strconv.Itoa(i+1))
+		}
+	}
+	return entries
+}
+
+// pageNumber parses the entry of a PDF or EPUB page.
+func pageNumber(entry string, count int) (int, error) {
+	n, err := strconv.Atoi(entry)
+	if err != nil || n < 1 || n > count {
+		return 0, fmt.Errorf("no page %q", entry)
+	}
+	return n, nil
+}
+
+// ReadFile reads a plain file or a page inside a container. PDF pages are
+// rendered to PNG.
+func ReadFile(p string) ([]byte, error) {
+	file, entry, ok := Split(p)
+	if !ok {
+		return os.ReadFile(p)
+	}
+	if strings.EqualFold(filepath.Ext(file), ".pdf") {
+		count, err := pdfPages(file)
+		if err != nil {
+			return nil, err
+		}
+		n, err := pageNumber(entry, count)
+		if err != nil {
+			return nil, err
+		}
+		return renderPDFPage(file, n)
+	}
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if strings.EqualFold(filepath.Ext(file), ".epub") {
+		images, err := epubImages(&r.Reader)
+		if err != nil {
+			return nil, err
+		}
+		n, err := pageNumber(entry, len(images))
+		if err != nil {
+			return nil, err
+		}
+		entry = images[n-1]
+	}
+	f, err := r.Open(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Open opens a plain file or a page inside a container for reading.
+func Open(p string) (io.ReadSeekCloser, error) {
+	if _, _, ok := Split(p); !ok {
+		return os.Open(p)
+	}
+	data, err := ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
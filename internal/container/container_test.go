@@ -0,0 +1,232 @@
+package container
+
+import (
+	"archive/zip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		path      string
+		wantFile  string
+		wantEntry string
+		wantOK    bool
+	}{
+		{"/manga/Berserk/Vol 01.cbz/012.png", "/manga/Berserk/Vol 01.cbz", "012.png", true},
+		{"/manga/Berserk/Vol 01.CBZ/inner/012.png", "/manga/Berserk/Vol 01.CBZ", "inner/012.png", true},
+		{"/manga/Berserk/Vol 01.cbz", "", "", false},
+		{"/manga/Berserk/ch1/012.png", "", "", false},
+		{"/manga/Berserk/Vol 02.pdf/12", "/manga/Berserk/Vol 02.pdf", "12", true},
+		{"/manga/Berserk/Vol 03.epub/7", "/manga/Berserk/Vol 03.epub", "7", true},
+	}
+	for _, tt := range tests {
+		file, entry, ok := Split(tt.path)
+		if file != tt.wantFile || entry != tt.wantEntry || ok != tt.wantOK {
+			t.Errorf("Split(%q) = %q, %q, %v; want %q, %q, %v", tt.path, file, entry, ok, tt.wantFile, tt.wantEntry, tt.wantOK)
+		}
+	}
+}
+
+func TestListAndRead(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "Vol 01.cbz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"10.png", "9.png", "notes.txt", "extras/", "extras/1.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("data:" + name))
+	}
+	zw.Close()
+	f.Close()
+
+	isPNG := func(name string) bool { return strings.HasSuffix(name, ".png") }
+	got, err := List(file, isPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"9.png", "10.png", "extras/1.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+
+	data, err := ReadFile(Join(file, "extras/1.png"))
+	if err != nil || string(data) != "data:extras/1.png" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+	if _, err := ReadFile(Join(file, "missing.png")); err == nil {
+		t.Error("reading a missing entry should fail")
+	}
+}
+
+func writeZip(t *testing.T, file string, entries [][2]string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEPUB(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "Vol 01.epub")
+	writeZip(t, file, [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" version="1.0">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="cover" href="images/cover.jpg" media-type="image/jpeg"/>
+    <item id="p1" href="text/p1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="p2" href="text/p2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="credits" href="text/credits.xhtml" media-type="application/xhtml+xml"/>
+    <item id="p3" href="text/p%203.xhtml" media-type="application/xhtml+xml"/>
+    <item id="p1img" href="images/z.png" media-type="image/png"/>
+    <item id="p2img" href="images/a.png" media-type="image/png"/>
+  </manifest>
+  <spine><itemref idref="cover"/><itemref idref="p1"/><itemref idref="p2"/><itemref idref="credits"/><itemref idref="p3"/></spine>
+</package>`},
+		{"OEBPS/images/cover.jpg", "cover"},
+		{"OEBPS/images/z.png", "first"},
+		{"OEBPS/images/a.png", "second"},
+		{"OEBPS/images/page 3.webp", "third"},
+		{"OEBPS/text/p1.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="../images/z.png" alt=""/></body></html>`},
+		{"OEBPS/text/p2.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><image xlink:href="../images/a.png"/></svg></body></html>`},
+		{"OEBPS/text/credits.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Thanks&nbsp;for reading</p></body></html>`},
+		{"OEBPS/text/p 3.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="../images/page%203.webp"></body></html>`},
+	})
+
+	notWebP := func(name string) bool { return !strings.HasSuffix(name, ".webp") }
+	got, err := List(file, notWebP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spine order, not file names; the text-only page has no number and
+	// the filtered WebP keeps its own.
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+	for entry, want := range map[string]string{"1": "cover", "2": "first", "3": "second", "4": "third"} {
+		data, err := ReadFile(Join(file, entry))
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%s) = %q, %v; want %q", entry, data, err, want)
+		}
+	}
+	for _, entry := range []string{"0", "5", "z.png"} {
+		if _, err := ReadFile(Join(file, entry)); err == nil {
+			t.Errorf("ReadFile(%s) should fail", entry)
+		}
+	}
+}
+
+// stubPoppler replaces pdfinfo and pdftoppm with scripts that report pages
+// pages and render every page as the page number. It returns a file that
+// pdfinfo appends a line to each time it runs.
+func stubPoppler(t *testing.T, pages int) (infoLog string) {
+	t.Helper()
+	dir := t.TempDir()
+	info := filepath.Join(dir, "pdfinfo")
+	render := filepath.Join(dir, "pdftoppm")
+	infoLog = filepath.Join(dir, "pdfinfo.log")
+	scripts := map[string]string{
+		info: "#!/bin/sh\necho run >> '" + infoLog + "'\necho 'Title: x'\necho 'Pages:          " + strconv.Itoa(pages) + "'\n",
+		// pdftoppm -png -r DPI -f N -l N -singlefile FILE OUT
+		render: "#!/bin/sh\nprintf 'page %s at %s' \"$5\" \"$3\" > \"${10}.png\"\n",
+	}
+	for path, body := range scripts {
+		if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldInfo, oldRender := pdfinfo, pdftoppm
+	pdfinfo, pdftoppm = info, render
+	t.Cleanup(func() { pdfinfo, pdftoppm = oldInfo, oldRender })
+	return infoLog
+}
+
+func TestPDF(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh for the poppler stubs")
+	}
+	infoLog := stubPoppler(t, 3)
+	file := filepath.Join(t.TempDir(), "Vol 01.pdf")
+	if err := os.WriteFile(file, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := List(file, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+	data, err := ReadFile(Join(file, "2"))
+	if err != nil || string(data) != "page 2 at 150" {
+		t.Errorf("ReadFile(2) = %q, %v", data, err)
+	}
+	if _, err := ReadFile(Join(file, "4")); err == nil {
+		t.Error("reading past the last page should fail")
+	}
+	if runs, _ := os.ReadFile(infoLog); strings.Count(string(runs), "run") != 1 {
+		t.Errorf("pdfinfo ran %d times, want once per volume", strings.Count(string(runs), "run"))
+	}
+
+	// A changed file is counted again.
+	if err := os.WriteFile(file, []byte("%PDF-1.4 changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(Join(file, "1")); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := os.ReadFile(infoLog); strings.Count(string(runs), "run") != 2 {
+		t.Errorf("pdfinfo ran %d times after the file changed, want 2", strings.Count(string(runs), "run"))
+	}
+}
+
+func TestPDFPoppler(t *testing.T) {
+	for _, tool := range []string{"pdfinfo", "pdftoppm"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	file := filepath.Join("testdata", "volume.pdf")
+	got, err := List(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+	data, err := ReadFile(Join(file, "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Error("page 2 is not a PNG")
+	}
+}
@@ -0,0 +1,125 @@
+package container
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// epubImages returns the images of an EPUB's spine in reading order. A
+// spine item is either an image itself or, as in fixed-layout comics, a
+// page showing one; pages without an image are skipped.
+func epubImages(r *zip.Reader) ([]string, error) {
+	var meta struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := readXML(r, "META-INF/container.xml", &meta); err != nil {
+		return nil, err
+	}
+	if len(meta.Rootfiles) == 0 {
+		return nil, errors.New("epub: container.xml names no package")
+	}
+	opf := meta.Rootfiles[0].FullPath
+
+	var pkg struct {
+		Items []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := readXML(r, opf, &pkg); err != nil {
+		return nil, err
+	}
+	type item struct{ href, mediaType string }
+	manifest := make(map[string]item, len(pkg.Items))
+	for _, it := range pkg.Items {
+		manifest[it.ID] = item{resolveHref(opf, it.Href), it.MediaType}
+	}
+
+	var images []string
+	for _, ref := range pkg.Spine {
+		it, ok := manifest[ref.IDRef]
+		if !ok {
+			return nil, fmt.Errorf("epub: spine item %q is not in the manifest", ref.IDRef)
+		}
+		switch {
+		case strings.HasPrefix(it.mediaType, "image/"):
+			images = append(images, it.href)
+		case it.mediaType == "application/xhtml+xml" || it.mediaType == "text/html":
+			img, err := pageImage(r, it.href)
+			if err != nil {
+				return nil, err
+			}
+			if img != "" {
+				images = append(images, img)
+			}
+		}
+	}
+	return images, nil
+}
+
+// pageImage returns the first image an XHTML page shows, or "".
+func pageImage(r *zip.Reader, page string) (string, error) {
+	f, err := r.Open(page)
+	if err != nil {
+		return "", fmt.Errorf("epub: %w", err)
+	}
+	defer f.Close()
+
+	d := xml.NewDecoder(f)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("epub %s: %w", page, err)
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range el.Attr {
+			// <img src> in HTML, <image xlink:href> in SVG
+			if (el.Name.Local == "img" && attr.Name.Local == "src") || (el.Name.Local == "image" && attr.Name.Local == "href") {
+				return resolveHref(page, attr.Value), nil
+			}
+		}
+	}
+}
+
+func readXML(r *zip.Reader, name string, v any) error {
+	f, err := r.Open(name)
+	if err != nil {
+		return fmt.Errorf("epub: %w", err)
+	}
+	defer f.Close()
+	if err := xml.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("epub %s: %w", name, err)
+	}
+	return nil
+}
+
+// resolveHref turns href, relative to the file from, into a path inside
+// the archive.
+func resolveHref(from, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(path.Dir(from), href)
+}
@@ -0,0 +1,106 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PDFDPI is the resolution PDF pages are rendered at.
+var PDFDPI = 150
+
+// PDFs are read with poppler-utils; tests swap in stubs.
+var (
+	pdfinfo  = "pdfinfo"
+	pdftoppm = "pdftoppm"
+)
+
+// pageCounts caches each PDF's page count, so reading a page doesn't run
+// pdfinfo again. An entry is used only while the file is unchanged.
+var pageCounts = struct {
+	sync.Mutex
+	m map[string]pageCount
+}{m: make(map[string]pageCount)}
+
+type pageCount struct {
+	size    int64
+	modTime time.Time
+	pages   int
+}
+
+// pdfPages returns how many pages file has, from the cache if it can.
+func pdfPages(file string) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	pageCounts.Lock()
+	c, ok := pageCounts.m[file]
+	pageCounts.Unlock()
+	if ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c.pages, nil
+	}
+	n, err := pdfPageCount(file)
+	if err != nil {
+		return 0, err
+	}
+	pageCounts.Lock()
+	pageCounts.m[file] = pageCount{size: info.Size(), modTime: info.ModTime(), pages: n}
+	pageCounts.Unlock()
+	return n, nil
+}
+
+// pdfPageCount asks pdfinfo how many pages file has.
+func pdfPageCount(file string) (int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(pdfinfo, file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, toolError(pdfinfo, err, &stderr)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if val, ok := strings.CutPrefix(scanner.Text(), "Pages:"); ok {
+			return strconv.Atoi(strings.TrimSpace(val))
+		}
+	}
+	return 0, fmt.Errorf("%s did not report a page count", pdfinfo)
+}
+
+// renderPDFPage renders page n, counting from 1, as a PNG.
+func renderPDFPage(file string, n int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "mangasearch-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "page")
+	page := strconv.Itoa(n)
+	var stderr bytes.Buffer
+	cmd := exec.Command(pdftoppm, "-png", "-r", strconv.Itoa(PDFDPI), "-f", page, "-l", page, "-singlefile", file, out)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, toolError(pdftoppm, err, &stderr)
+	}
+	data, err := os.ReadFile(out + ".png")
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no page %d: %w", pdftoppm, n, err)
+	}
+	return data, nil
+}
+
+func toolError(tool string, err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s: %w: %s", tool, err, msg)
+	}
+	return fmt.Errorf("%s: %w", tool, err)
+}
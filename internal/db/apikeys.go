@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	ScopeSearch = "search"
+	ScopeAdmin  = "admin"
+
+	apiKeyPrefix = "ms_"
+)
+
+// APIKey describes a key. The key itself is only shown once, when created;
+// the database keeps its SHA-256.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Allows reports whether a key with this scope may use an endpoint that
+// needs scope. Admin keys can also search.
+func (k APIKey) Allows(scope string) bool {
+	return k.Scope == ScopeAdmin || k.Scope == scope
+}
+
+func ValidScope(scope string) bool {
+	return scope == ScopeSearch || scope == ScopeAdmin
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey generates a new key and returns it in clear text.
+func (db *DB) CreateAPIKey(ctx context.Context, name, scope string) (string, APIKey, error) {
+	if !ValidScope(scope) {
+		return "", APIKey{}, fmt.Errorf("unknown scope %q (want %s or %s)", scope, ScopeSearch, ScopeAdmin)
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", APIKey{}, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(raw)
+
+	k := APIKey{Name: name, Prefix: key[:len(apiKeyPrefix)+6], Scope: scope}
+	err := db.Conn.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, hash, scope)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, k.Name, k.Prefix, hashAPIKey(key), k.Scope).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	return key, k, nil
+}
+
+func (db *DB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT id, name, prefix, scope, created_at, last_used_at, revoked_at
+		FROM api_keys ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scope, &k.CreatedAt, &lastUsed, &revoked); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			k.RevokedAt = &revoked.Time
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+// RevokeAPIKey disables a key for good. It reports false if no active key
+// has that id.
+func (db *DB) RevokeAPIKey(ctx context.Context, id int64) (bool, error) {
+	res, err := db.Conn.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// lastUsedResolution is how stale last_used_at may get before a lookup
+// writes it again, so busy clients don't cost an UPDATE per request.
+const lastUsedResolution = time.Minute
+
+// LookupAPIKey finds the active key matching key and records its use.
+func (db *DB) LookupAPIKey(ctx context.Context, key string) (APIKey, bool, error) {
+	var k APIKey
+	var lastUsed sql.NullTime
+	err := db.Conn.QueryRowContext(ctx, `
+		SELECT id, name, prefix, scope, created_at, last_used_at
+		FROM api_keys
+		WHERE hash = $1 AND revoked_at IS NULL
+	`, hashAPIKey(key)).Scan(&k.ID, &k.Name, &k.Prefix, &k.Scope, &k.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+	if lastUsed.Valid {
+		k.LastUsedAt = &lastUsed.Time
+	}
+	if !lastUsed.Valid || time.Since(lastUsed.Time) >= lastUsedResolution {
+		if _, err := db.Conn.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, k.ID); err != nil {
+			return APIKey{}, false, err
+		}
+	}
+	return k, true, nil
+}
+
+// CountAPIKeys counts the keys that have not been revoked.
+func (db *DB) CountAPIKeys(ctx context.Context) (int, error) {
+	var n int
+	err := db.Conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_keys WHERE revoked_at IS NULL`).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"mangasearch/internal/natsort"
+)
+
+type SeriesSummary struct {
+	Library     string    `json:"library"`
+	Series      string    `json:"series"`
+	Chapters    int       `json:"chapters"`
+	Pages       int       `json:"pages"`
+	Failed      int       `json:"failed"`
+	LastIndexed time.Time `json:"last_indexed"`
+}
+
+type ChapterSummary struct {
+	Chapter     string    `json:"chapter"`
+	Pages       int       `json:"pages"`
+	Failed      int       `json:"failed"`
+	LastIndexed time.Time `json:"last_indexed"`
+}
+
+type PageSummary struct {
+	ID        int64     `json:"id"`
+	Page      string    `json:"page"`
+	Path      string    `json:"path"`
+	Text      string    `json:"text"`
+	Language  string    `json:"language"`
+	Corrected bool      `json:"corrected"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	IndexedAt time.Time `json:"indexed_at"`
+}
+
+func (db *DB) ListSeries(ctx context.Context) ([]SeriesSummary, error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT library, series,
+			COUNT(DISTINCT chapter),
+			COUNT(*) FILTER (WHERE status = 'indexed'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			MAX(created_at)
+		FROM pages
+		WHERE deleted_at IS NULL
+		GROUP BY library, series
+		ORDER BY series, library
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []SeriesSummary{}
+	for rows.Next() {
+		var s SeriesSummary
+		if err := rows.Scan(&s.Library, &s.Series, &s.Chapters, &s.Pages, &s.Failed, &s.LastIndexed); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func (db *DB) ListChapters(ctx context.Context, series string) ([]ChapterSummary, error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT chapter,
+			COUNT(*) FILTER (WHERE status = 'indexed'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			MAX(created_at)
+		FROM pages
+		WHERE series = $1 AND deleted_at IS NULL
+		GROUP BY chapter
+	`, series)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []ChapterSummary{}
+	for rows.Next() {
+		var c ChapterSummary
+		if err := rows.Scan(&c.Chapter, &c.Pages, &c.Failed, &c.LastIndexed); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return natsort.Less(list[i].Chapter, list[j].Chapter) })
+	return list, rows.Err()
+}
+
+func (db *DB) ListPages(ctx context.Context, series, chapter string) ([]PageSummary, error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT p.id, p.page, p.path, COALESCE(c.text, p.text), c.path IS NOT NULL,
+			p.language, p.status, p.error, p.created_at
+		FROM pages p
+		LEFT JOIN corrections c ON c.path = p.path
+		WHERE p.series = $1 AND p.chapter = $2 AND p.deleted_at IS NULL
+	`, series, chapter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []PageSummary{}
+	for rows.Next() {
+		var p PageSummary
+		if err := rows.Scan(&p.ID, &p.Page, &p.Path, &p.Text, &p.Corrected, &p.Language, &p.Status, &p.Error, &p.IndexedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return natsort.Less(list[i].Page, list[j].Page) })
+	return list, rows.Err()
+}
+
+// MarkPageFailed records a page that ran out of retries. It keeps its row so
+// it shows up in the catalog, and is retried on the next scan.
+func (db *DB) MarkPageFailed(ctx context.Context, p Page, reason string) error {
+	_, err := db.Conn.ExecContext(ctx, `
+		INSERT INTO pages (path, library, series, chapter, page, text, status, error, created_at)
+		VALUES ($1, $2, $3, $4, $5, '', 'failed', $6, NOW())
+		ON CONFLICT (path) DO UPDATE SET
+			status     = 'failed',
+			error      = EXCLUDED.error,
+			deleted_at = NULL,
+			created_at = NOW()
+	`, p.Path, p.Library, p.Series, p.Chapter, p.Page, reason)
+	return err
+}
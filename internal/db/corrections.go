@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Corrections are keyed by path rather than page id so they survive
+// rebuilds, which delete and recreate page rows.
+
+type Correction struct {
+	Text      string    `json:"text"`
+	Author    string    `json:"author"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CorrectionChange struct {
+	ID        int64     `json:"id"`
+	OldText   *string   `json:"old_text"`
+	NewText   *string   `json:"new_text"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) GetCorrection(ctx context.Context, path string) (Correction, bool, error) {
+	var c Correction
+	err := db.Conn.QueryRowContext(ctx, `
+		SELECT text, author, updated_at FROM corrections WHERE path = $1
+	`, path).Scan(&c.Text, &c.Author, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return Correction{}, false, nil
+	}
+	if err != nil {
+		return Correction{}, false, err
+	}
+	return c, true, nil
+}
+
+// SetCorrection stores text as the human version of the page at path and
+// records the change.
+func (db *DB) SetCorrection(ctx context.Context, path, text, author string) error {
+	return db.changeCorrection(ctx, path, &text, author)
+}
+
+// ClearCorrection drops the correction for path, if any, so the machine text
+// shows again. The removal is recorded.
+func (db *DB) ClearCorrection(ctx context.Context, path, author string) error {
+	return db.changeCorrection(ctx, path, nil, author)
+}
+
+func (db *DB) changeCorrection(ctx context.Context, path string, text *string, author string) error {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT text FROM corrections WHERE path = $1 FOR UPDATE`, path).Scan(&old)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if text == nil && !old.Valid {
+		return nil
+	}
+
+	if text == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM corrections WHERE path = $1`, path)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO corrections (path, text, author, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (path) DO UPDATE SET
+				text       = EXCLUDED.text,
+				author     = EXCLUDED.author,
+				updated_at = NOW()
+		`, path, *text, author)
+	}
+	if err != nil {
+		return err
+	}
+
+	var oldText *string
+	if old.Valid {
+		oldText = &old.String
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO correction_history (path, old_text, new_text, author)
+		VALUES ($1, $2, $3, $4)
+	`, path, oldText, text, author); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CorrectionHistory lists every change to the correction of path, newest
+// first. A nil NewText is a removal.
+func (db *DB) CorrectionHistory(ctx context.Context, path string) ([]CorrectionChange, error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT id, old_text, new_text, author, created_at
+		FROM correction_history
+		WHERE path = $1
+		ORDER BY created_at DESC, id DESC
+	`, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []CorrectionChange{}
+	for rows.Next() {
+		var c CorrectionChange
+		var oldText, newText sql.NullString
+		if err := rows.Scan(&c.ID, &oldText, &newText, &c.Author, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if oldText.Valid {
+			c.OldText = &oldText.String
+		}
+		if newText.Valid {
+			c.NewText = &newText.String
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
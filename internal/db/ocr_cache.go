@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"mangasearch/internal/ocr"
+)
+
+type OCRCacheKey struct {
+	Hash      string
+	Engine    string
+	Version   string
+	Languages string
+	Direction string
+}
+
+type OCRCacheEntry struct {
+	Text      string
+	Fragments []ocr.Fragment
+}
+
+func (db *DB) GetOCRCache(ctx context.Context, key OCRCacheKey) (OCRCacheEntry, bool, error) {
+	var entry OCRCacheEntry
+	var fragments []byte
+	err := db.Conn.QueryRowContext(ctx, `
+		SELECT text, fragments FROM ocr_cache
+		WHERE hash = $1 AND engine = $2 AND version = $3 AND languages = $4 AND direction = $5
+	`, key.Hash, key.Engine, key.Version, key.Languages, key.Direction).Scan(&entry.Text, &fragments)
+	if err == sql.ErrNoRows {
+		return OCRCacheEntry{}, false, nil
+	}
+	if err != nil {
+		return OCRCacheEntry{}, false, err
+	}
+	if err := json.Unmarshal(fragments, &entry.Fragments); err != nil {
+		return OCRCacheEntry{}, false, fmt.Errorf("GetOCRCache unmarshal fragments: %w", err)
+	}
+	return entry, true, nil
+}
+
+func (db *DB) SaveOCRCache(ctx context.Context, key OCRCacheKey, entry OCRCacheEntry) error {
+	if entry.Fragments == nil {
+		entry.Fragments = []ocr.Fragment{}
+	}
+	fragments, err := json.Marshal(entry.Fragments)
+	if err != nil {
+		return fmt.Errorf("SaveOCRCache marshal fragments: %w", err)
+	}
+	_, err = db.Conn.ExecContext(ctx, `
+		INSERT INTO ocr_cache (hash, engine, version, languages, direction, text, fragments, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (hash, engine, version, languages, direction) DO UPDATE SET
+			text       = EXCLUDED.text,
+			fragments  = EXCLUDED.fragments,
+			created_at = NOW()
+	`, key.Hash, key.Engine, key.Version, key.Languages, key.Direction, entry.Text, string(fragments))
+	return err
+}
@@ -2,22 +2,165 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
+
+	"mangasearch/internal/natsort"
+	"mangasearch/internal/textblock"
+
+	"github.com/lib/pq"
 )
 
-func (db *DB) SavePage(ctx context.Context, series, chapter, page, path, text string) error {
-	_, err := db.Conn.ExecContext(ctx, `
-		INSERT INTO pages (path, series, chapter, page, text, created_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+type Page struct {
+	ID       int64
+	Path     string
+	Library  string
+	Series   string
+	Chapter  string
+	Page     string
+	Text     string
+	Language string
+	Blocks   []textblock.Block
+
+	// Correction is a human fix of Text, set when Corrected is true.
+	Correction string
+	Corrected  bool
+}
+
+// EffectiveText is the correction if there is one, otherwise the OCR text.
+func (p Page) EffectiveText() string {
+	if p.Corrected {
+		return p.Correction
+	}
+	return p.Text
+}
+
+// EffectiveBlocks are the OCR blocks, or one block per line of the
+// correction, mirroring how textblock.Join lays blocks out.
+func (p Page) EffectiveBlocks() []textblock.Block {
+	if !p.Corrected {
+		return p.Blocks
+	}
+	var blocks []textblock.Block
+	for _, line := range strings.Split(p.Correction, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		blocks = append(blocks, textblock.Block{Index: len(blocks), Text: line})
+	}
+	return blocks
+}
+
+// SavePage upserts the page and returns its stable ID.
+func (db *DB) SavePage(ctx context.Context, p Page) (int64, error) {
+	if p.Blocks == nil {
+		p.Blocks = []textblock.Block{}
+	}
+	blocks, err := json.Marshal(p.Blocks)
+	if err != nil {
+		return 0, fmt.Errorf("SavePage marshal blocks: %w", err)
+	}
+	var id int64
+	err = db.Conn.QueryRowContext(ctx, `
+		INSERT INTO pages (path, library, series, chapter, page, text, language, blocks, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
 		ON CONFLICT (path) DO UPDATE SET
+			library    = EXCLUDED.library,
 			text       = EXCLUDED.text,
+			language   = EXCLUDED.language,
+			blocks     = EXCLUDED.blocks,
+			status     = 'indexed',
+			error      = '',
+			deleted_at = NULL,
 			created_at = NOW()
-	`, path, series, chapter, page, text)
-	return err
+		RETURNING id
+	`, p.Path, p.Library, p.Series, p.Chapter, p.Page, p.Text, p.Language, string(blocks)).Scan(&id)
+	return id, err
+}
+
+func (db *DB) GetPage(ctx context.Context, id int64) (Page, bool, error) {
+	var p Page
+	var blocks []byte
+	var correction sql.NullString
+	err := db.Conn.QueryRowContext(ctx, `
+		SELECT p.id, p.path, p.library, p.series, p.chapter, p.page, p.text, p.language, p.blocks, c.text
+		FROM pages p
+		LEFT JOIN corrections c ON c.path = p.path
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+	`, id).Scan(&p.ID, &p.Path, &p.Library, &p.Series, &p.Chapter, &p.Page, &p.Text, &p.Language, &blocks, &correction)
+	if err == sql.ErrNoRows {
+		return Page{}, false, nil
+	}
+	if err != nil {
+		return Page{}, false, err
+	}
+	if err := json.Unmarshal(blocks, &p.Blocks); err != nil {
+		return Page{}, false, fmt.Errorf("GetPage unmarshal blocks: %w", err)
+	}
+	p.Correction, p.Corrected = correction.String, correction.Valid
+	return p, true, nil
+}
+
+// PageNeighbors returns the IDs of the pages before and after p in its
+// series and library, crossing chapter boundaries. Chapters and pages are in natural
+// order, so ch9 comes before ch10. Zero means there is none.
+func (db *DB) PageNeighbors(ctx context.Context, p Page) (prev, next int64, err error) {
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT id, chapter, page FROM pages WHERE series = $1 AND library = $2 AND deleted_at IS NULL
+	`, p.Series, p.Library)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var pages []Page
+	for rows.Next() {
+		var n Page
+		if err := rows.Scan(&n.ID, &n.Chapter, &n.Page); err != nil {
+			return 0, 0, err
+		}
+		pages = append(pages, n)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	sort.Slice(pages, func(i, j int) bool { return pageLess(pages[i], pages[j]) })
+	for i, n := range pages {
+		if n.ID != p.ID {
+			continue
+		}
+		if i > 0 {
+			prev = pages[i-1].ID
+		}
+		if i < len(pages)-1 {
+			next = pages[i+1].ID
+		}
+		break
+	}
+	return prev, next, nil
 }
 
+func pageLess(a, b Page) bool {
+	if a.Chapter != b.Chapter {
+		return natsort.Less(a.Chapter, b.Chapter)
+	}
+	return natsort.Less(a.Page, b.Page)
+}
+
+// LoadSnapshots returns when each known page was last indexed. Failed pages
+// report the epoch so the next scan queues them again. Soft-deleted pages
+// are left out, so they are queued again if their file comes back.
 func (db *DB) LoadSnapshots(ctx context.Context) (map[string]time.Time, error) {
-	rows, err := db.Conn.QueryContext(ctx, `SELECT path, created_at FROM pages`)
+	rows, err := db.Conn.QueryContext(ctx, `
+		SELECT path, CASE WHEN status = 'failed' THEN 'epoch'::timestamptz ELSE created_at END
+		FROM pages
+		WHERE deleted_at IS NULL
+	`)
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +186,28 @@ func (db *DB) DeletePage(ctx context.Context, path string) error {
 	return err
 }
 
+// SoftDeletePages marks pages whose files are gone. Their rows, and any
+// corrections, stay until PurgeDeletedPages removes them.
+func (db *DB) SoftDeletePages(ctx context.Context, paths []string) (int64, error) {
+	res, err := db.Conn.ExecContext(ctx, `
+		UPDATE pages SET deleted_at = NOW()
+		WHERE path = ANY($1) AND deleted_at IS NULL
+	`, pq.Array(paths))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeDeletedPages removes pages soft-deleted before cutoff.
+func (db *DB) PurgeDeletedPages(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.Conn.ExecContext(ctx, `DELETE FROM pages WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (db *DB) DeleteAllPages(ctx context.Context) error {
 	_, err := db.Conn.ExecContext(ctx, `DELETE FROM pages`)
 	return err
@@ -50,7 +215,7 @@ func (db *DB) DeleteAllPages(ctx context.Context) error {
 
 func (db *DB) CountPages(ctx context.Context) (int, error) {
 	var count int
-	row := db.Conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages`)
+	row := db.Conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE status = 'indexed' AND deleted_at IS NULL`)
 	if err := row.Scan(&count); err != nil {
 		return 0, err
 	}
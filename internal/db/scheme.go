@@ -2,16 +2,67 @@ package db
 
 import "context"
 
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS pages (
+		path       TEXT PRIMARY KEY,
+		series     TEXT        NOT NULL,
+		chapter    TEXT        NOT NULL,
+		page       TEXT        NOT NULL,
+		text       TEXT        NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT 'en'`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS blocks JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS id BIGSERIAL`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS pages_id_idx ON pages (id)`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'indexed'`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS pages_series_chapter_idx ON pages (series, chapter)`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS library TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`,
+	`CREATE TABLE IF NOT EXISTS ocr_cache (
+		hash       TEXT        NOT NULL,
+		engine     TEXT        NOT NULL,
+		version    TEXT        NOT NULL,
+		languages  TEXT        NOT NULL,
+		direction  TEXT        NOT NULL,
+		text       TEXT        NOT NULL,
+		fragments  JSONB       NOT NULL DEFAULT '[]',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (hash, engine, version, languages, direction)
+	)`,
+	`CREATE TABLE IF NOT EXISTS corrections (
+		path       TEXT PRIMARY KEY,
+		text       TEXT        NOT NULL,
+		author     TEXT        NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS correction_history (
+		id         BIGSERIAL PRIMARY KEY,
+		path       TEXT        NOT NULL,
+		old_text   TEXT,
+		new_text   TEXT,
+		author     TEXT        NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS correction_history_path_idx ON correction_history (path, created_at)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id           BIGSERIAL PRIMARY KEY,
+		name         TEXT        NOT NULL,
+		prefix       TEXT        NOT NULL,
+		hash         TEXT        NOT NULL UNIQUE,
+		scope        TEXT        NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		revoked_at   TIMESTAMPTZ
+	)`,
+}
+
 func (db *DB) CreateSchema(ctx context.Context) error {
-	_, err := db.Conn.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS pages (
-			path       TEXT PRIMARY KEY,
-			series     TEXT        NOT NULL,
-			chapter    TEXT        NOT NULL,
-			page       TEXT        NOT NULL,
-			text       TEXT        NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		)
-	`)
-	return err
+	for _, stmt := range schema {
+		if _, err := db.Conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
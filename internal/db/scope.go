@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"strings"
+)
+
+// Scope selects the pages of a partial rebuild. Empty fields match
+// everything; Chapter only makes sense together with Series.
+type Scope struct {
+	Library string
+	Series  string
+	Chapter string
+	Prefix  string
+}
+
+func (s Scope) IsZero() bool {
+	return s == Scope{}
+}
+
+// MatchesPage reports whether the page at path, already parsed into its
+// library, series and chapter, falls inside the scope.
+func (s Scope) MatchesPage(path, library, series, chapter string) bool {
+	if s.Prefix != "" && !strings.HasPrefix(path, s.Prefix) {
+		return false
+	}
+	return (s.Library == "" || library == s.Library) &&
+		(s.Series == "" || series == s.Series) &&
+		(s.Chapter == "" || chapter == s.Chapter)
+}
+
+// DeletePages removes every page inside the scope.
+func (db *DB) DeletePages(ctx context.Context, s Scope) (int64, error) {
+	res, err := db.Conn.ExecContext(ctx, `
+		DELETE FROM pages
+		WHERE ($1 = '' OR series = $1)
+			AND ($2 = '' OR chapter = $2)
+			AND ($3 = '' OR starts_with(path, $3))
+			AND ($4 = '' OR library = $4)
+	`, s.Series, s.Chapter, s.Prefix, s.Library)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
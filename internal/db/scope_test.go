@@ -0,0 +1,46 @@
+package db
+
+import "testing"
+
+func TestScopeMatchesPath(t *testing.T) {
+	tests := []struct {
+		scope                 Scope
+		path, series, chapter string
+		want                  bool
+	}{
+		{Scope{}, "/manga/Berserk/ch1/001.png", "Berserk", "ch1", true},
+		{Scope{Series: "Berserk"}, "/manga/Berserk/ch1/001.png", "Berserk", "ch1", true},
+		{Scope{Series: "Berserk"}, "/manga/Vagabond/ch1/001.png", "Vagabond", "ch1", false},
+		{Scope{Series: "Berserk", Chapter: "ch1"}, "/manga/Berserk/ch1/001.png", "Berserk", "ch1", true},
+		{Scope{Series: "Berserk", Chapter: "ch1"}, "/manga/Berserk/ch10/001.png", "Berserk", "ch10", false},
+		{Scope{Series: "Berserk", Chapter: "Vol 01"}, "/manga/Berserk/Vol 01.cbz/001.png", "Berserk", "Vol 01", true},
+		{Scope{Prefix: "/manga/Berserk/"}, "/manga/Berserk/ch1/001.png", "Berserk", "ch1", true},
+		{Scope{Prefix: "/manga/Berserk/"}, "/manga/Berserk Deluxe/ch1/001.png", "Berserk Deluxe", "ch1", false},
+		{Scope{Prefix: "/manga/", Series: "Vagabond"}, "/manga/Berserk/ch1/001.png", "Berserk", "ch1", false},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.MatchesPage(tt.path, "default", tt.series, tt.chapter); got != tt.want {
+			t.Errorf("%+v.MatchesPage(%q) = %v, want %v", tt.scope, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestScopeMatchesPage(t *testing.T) {
+	tests := []struct {
+		scope   Scope
+		library string
+		want    bool
+	}{
+		{Scope{}, "comics", true},
+		{Scope{Library: "comics"}, "comics", true},
+		{Scope{Library: "comics"}, "manga", false},
+		{Scope{Library: "comics", Series: "Saga"}, "comics", true},
+		{Scope{Library: "comics", Series: "Berserk"}, "comics", false},
+		{Scope{Library: "comics", Prefix: "/media/manga/"}, "comics", false},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.MatchesPage("/media/comics/Saga/Vol 1/01.jpg", tt.library, "Saga", "Vol 1"); got != tt.want {
+			t.Errorf("%+v.MatchesPage(library %q) = %v, want %v", tt.scope, tt.library, got, tt.want)
+		}
+	}
+}
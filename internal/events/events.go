@@ -0,0 +1,87 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	PageQueued      = "page.queued"
+	OCRStarted      = "ocr.started"
+	PageIndexed     = "page.indexed"
+	PageFailed      = "page.failed"
+	ScanStarted     = "scan.started"
+	ScanFinished    = "scan.finished"
+	ScanFailed      = "scan.failed"
+	RebuildProgress = "rebuild.progress"
+)
+
+type Event struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Path     string    `json:"path,omitempty"`
+	Library  string    `json:"library,omitempty"`
+	PageID   int64     `json:"page_id,omitempty"`
+	Worker   int       `json:"worker,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	ToIndex  int       `json:"to_index,omitempty"`
+	ToDelete int       `json:"to_delete,omitempty"`
+	Done     int       `json:"done,omitempty"`
+	Total    int       `json:"total,omitempty"`
+}
+
+// Bus fans events out to every subscriber. Publishing never blocks: a
+// subscriber that falls behind loses events rather than stalling workers.
+// A nil *Bus is valid and drops everything.
+type Bus struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	e.ID = b.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function that
+// unsubscribes and closes it.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	if b == nil {
+		close(ch)
+		return ch, func() {}
+	}
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
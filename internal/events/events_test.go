@@ -0,0 +1,39 @@
+package events
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	a, cancelA := bus.Subscribe(4)
+	b, cancelB := bus.Subscribe(1)
+	defer cancelA()
+
+	bus.Publish(Event{Type: PageQueued, Path: "/manga/Berserk/ch1/001.png"})
+	bus.Publish(Event{Type: PageIndexed, PageID: 7})
+
+	first := <-a
+	if first.ID != 1 || first.Type != PageQueued || first.Time.IsZero() {
+		t.Fatalf("first event = %+v", first)
+	}
+	if second := <-a; second.ID != 2 || second.PageID != 7 {
+		t.Fatalf("second event = %+v", second)
+	}
+
+	// b's buffer only held the first event; the second was dropped.
+	if got := <-b; got.ID != 1 {
+		t.Fatalf("slow subscriber got %+v", got)
+	}
+	cancelB()
+	if _, ok := <-b; ok {
+		t.Fatal("channel should be closed after cancel")
+	}
+	cancelB()
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: ScanStarted})
+	ch, cancel := nilBus.Subscribe(1)
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("nil bus should hand out a closed channel")
+	}
+}
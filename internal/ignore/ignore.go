@@ -0,0 +1,206 @@
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileName is the ignore file looked up in every scanned folder. It takes
+// .gitignore syntax; its patterns apply to the folder and everything below.
+const FileName = ".mangasearchignore"
+
+// Rule is one pattern and where it came from.
+type Rule struct {
+	Pattern string
+	Source  string
+	Line    int
+
+	base     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+func (r Rule) String() string {
+	if r.Line == 0 {
+		return fmt.Sprintf("%s: %s", r.Source, r.Pattern)
+	}
+	return fmt.Sprintf("%s:%d: %s", r.Source, r.Line, r.Pattern)
+}
+
+// Negated reports whether the rule re-includes what it matches.
+func (r Rule) Negated() bool {
+	return r.negate
+}
+
+// Compile parses one gitignore-style line. Patterns are relative to base.
+// ok is false for blank lines and comments.
+func Compile(base, source string, line int, text string) (r Rule, ok bool, err error) {
+	r = Rule{Pattern: text, Source: source, Line: line, base: filepath.Clean(base)}
+	text = trimTrailingSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return Rule{}, false, nil
+	}
+	if strings.HasPrefix(text, "!") {
+		r.negate = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\!`) || strings.HasPrefix(text, `\#`) {
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		r.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	if text == "" {
+		return Rule{}, false, fmt.Errorf("%s: empty pattern", r)
+	}
+	if strings.Contains(text, "/") {
+		r.anchored = true
+		text = strings.TrimPrefix(text, "/")
+	}
+	expr, err := globToRegexp(text)
+	if err != nil {
+		return Rule{}, false, fmt.Errorf("%s: %w", r, err)
+	}
+	r.re, err = regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, false, fmt.Errorf("%s: %w", r, err)
+	}
+	return r, true, nil
+}
+
+// trimTrailingSpace drops trailing spaces unless they are escaped.
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && (i == 0 || glob[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", errors.New("unclosed [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// match reports whether the rule applies to p, an absolute path.
+func (r Rule) match(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if r.anchored {
+		return r.re.MatchString(rel)
+	}
+	return r.re.MatchString(path.Base(rel))
+}
+
+// Rules are the patterns in effect in one folder, outermost first.
+type Rules []Rule
+
+// Global compiles patterns from the config, relative to root.
+func Global(root string, patterns []string) (Rules, error) {
+	var rules Rules
+	for _, p := range patterns {
+		r, ok, err := Compile(root, "config", 0, p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// Load returns rs followed by the rules of dir's ignore file, if it has
+// one. On error rs is returned unchanged.
+func (rs Rules) Load(dir string) (Rules, error) {
+	name := filepath.Join(dir, FileName)
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rs, nil
+	}
+	if err != nil {
+		return rs, err
+	}
+	defer f.Close()
+
+	// Copy so sibling folders never share a backing array.
+	out := append(Rules(nil), rs...)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		r, ok, err := Compile(dir, name, line, scanner.Text())
+		if err != nil {
+			return rs, err
+		}
+		if ok {
+			out = append(out, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rs, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// Match returns the last rule matching p. p is ignored if there is one and
+// it isn't negated.
+func (rs Rules) Match(p string, isDir bool) (Rule, bool) {
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].match(p, isDir) {
+			return rs[i], true
+		}
+	}
+	return Rule{}, false
+}
+
+// Ignored reports whether p is excluded.
+func (rs Rules) Ignored(p string, isDir bool) bool {
+	r, ok := rs.Match(p, isDir)
+	return ok && !r.negate
+}
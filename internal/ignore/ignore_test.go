@@ -0,0 +1,96 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulesMatch(t *testing.T) {
+	rules, err := Global("/manga", []string{
+		"@eaDir/",
+		"*credits*",
+		"!keep-credits.png",
+		"/covers",
+		"Berserk/**/extras",
+		"scan?.jpg",
+		"[Tt]rash/",
+		`\#notes.png`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/manga/Berserk/@eaDir", true, true},
+		{"/manga/Berserk/@eaDir", false, false},
+		{"/manga/Berserk/ch1/00_credits.png", false, true},
+		{"/manga/Berserk/ch1/keep-credits.png", false, false},
+		{"/manga/Berserk/Vol 1.cbz/credits.jpg", false, true},
+		{"/manga/covers", true, true},
+		{"/manga/Berserk/covers", true, false},
+		{"/manga/Berserk/extras", true, true},
+		{"/manga/Berserk/ch1/bonus/extras", true, true},
+		{"/manga/Vagabond/extras", true, false},
+		{"/manga/Berserk/ch1/scan1.jpg", false, true},
+		{"/manga/Berserk/ch1/scan10.jpg", false, false},
+		{"/manga/trash", true, true},
+		{"/manga/Trash", true, true},
+		{"/manga/Berserk/ch1/#notes.png", false, true},
+		{"/manga/Berserk/ch1/001.png", false, false},
+		{"/elsewhere/credits.png", false, false},
+	}
+	for _, tt := range tests {
+		if got := rules.Ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestRulesLoad(t *testing.T) {
+	root := t.TempDir()
+	series := filepath.Join(root, "Berserk")
+	if err := os.Mkdir(series, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(dir, body string) {
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(root, "# NAS junk\n*.tmp.png\n\ncover.jpg\n")
+	write(series, "!cover.jpg\n")
+
+	top, err := Rules(nil).Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := top.Load(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || len(inner) != 3 {
+		t.Fatalf("loaded %d and %d rules, want 2 and 3", len(top), len(inner))
+	}
+	if !top.Ignored(filepath.Join(root, "Vagabond", "cover.jpg"), false) {
+		t.Error("cover.jpg not ignored by the root file")
+	}
+	if inner.Ignored(filepath.Join(series, "cover.jpg"), false) {
+		t.Error("cover.jpg not re-included by the series file")
+	}
+	r, ok := inner.Match(filepath.Join(series, "ch1", "x.tmp.png"), false)
+	if !ok || r.Line != 2 || r.Source != filepath.Join(root, FileName) {
+		t.Errorf("Match = %v, %v; want line 2 of the root file", r, ok)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, p := range []string{"[abc", "!", "/"} {
+		if _, err := Global("/manga", []string{p}); err == nil {
+			t.Errorf("Global(%q) succeeded, want an error", p)
+		}
+	}
+}
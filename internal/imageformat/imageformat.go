@@ -0,0 +1,147 @@
+package imageformat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// extensions maps each supported format to its file extensions.
+var extensions = map[string][]string{
+	"jpeg": {".jpg", ".jpeg"},
+	"png":  {".png"},
+	"webp": {".webp"},
+	"avif": {".avif"},
+	"gif":  {".gif"},
+	"jxl":  {".jxl"},
+}
+
+// Default is every supported format.
+var Default = []string{"jpeg", "png", "webp", "avif", "gif", "jxl"}
+
+// DefaultConverter turns any image ImageMagick reads on stdin into a PNG
+// on stdout.
+var DefaultConverter = []string{"magick", "-", "png:-"}
+
+// Converted lists the formats in formats that Decode hands to the
+// converter.
+func Converted(formats []string) []string {
+	var converted []string
+	for _, f := range formats {
+		if f = strings.ToLower(f); f == "avif" || f == "jxl" {
+			converted = append(converted, f)
+		}
+	}
+	return converted
+}
+
+// ConverterInstalled reports whether the converter's command is on PATH.
+func ConverterInstalled(converter []string) bool {
+	if len(converter) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(converter[0])
+	return err == nil
+}
+
+// Set is the file extensions of a list of formats.
+type Set map[string]bool
+
+func NewSet(formats []string) (Set, error) {
+	s := make(Set)
+	for _, f := range formats {
+		exts, ok := extensions[strings.ToLower(f)]
+		if !ok {
+			return nil, fmt.Errorf("unknown image format %q (known: %s)", f, strings.Join(Known(), ", "))
+		}
+		for _, ext := range exts {
+			s[ext] = true
+		}
+	}
+	return s, nil
+}
+
+// Known lists the supported formats by name.
+func Known() []string {
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Match reports whether name has the extension of one of the formats.
+func (s Set) Match(name string) bool {
+	return s[strings.ToLower(filepath.Ext(name))]
+}
+
+// Sniff names the format of raw from its first bytes, or returns "" if it
+// isn't one it knows.
+func Sniff(raw []byte) string {
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xff, 0xd8, 0xff}):
+		return "jpeg"
+	case bytes.HasPrefix(raw, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(raw, []byte("GIF8")):
+		return "gif"
+	case len(raw) >= 12 && string(raw[:4]) == "RIFF" && string(raw[8:12]) == "WEBP":
+		return "webp"
+	case len(raw) >= 12 && string(raw[4:8]) == "ftyp" && (string(raw[8:12]) == "avif" || string(raw[8:12]) == "avis"):
+		return "avif"
+	case bytes.HasPrefix(raw, []byte{0xff, 0x0a}), bytes.HasPrefix(raw, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")):
+		return "jxl"
+	}
+	return ""
+}
+
+// OCRReady reports whether the OCR engine takes raw as it is.
+func OCRReady(raw []byte) bool {
+	f := Sniff(raw)
+	return f == "jpeg" || f == "png"
+}
+
+// Decode decodes raw. JPEG, PNG, GIF (its first frame) and WebP are decoded
+// in Go; AVIF and JPEG XL go through converter, a command reading the image
+// on stdin and writing a PNG to stdout.
+func Decode(raw []byte, converter []string) (image.Image, error) {
+	format := Sniff(raw)
+	if format != "avif" && format != "jxl" {
+		img, _, err := image.Decode(bytes.NewReader(raw))
+		return img, err
+	}
+	if len(converter) == 0 {
+		return nil, fmt.Errorf("%s needs an image converter, and none is set", format)
+	}
+	cmd := exec.Command(converter[0], converter[1:]...)
+	cmd.Stdin = bytes.NewReader(raw)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("convert %s with %s: %w", format, converter[0], err)
+	}
+	img, _, err := image.Decode(&stdout)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			err = fmt.Errorf("%s did not write an image", converter[0])
+		}
+		return nil, fmt.Errorf("convert %s: %w", format, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,167 @@
+package imageformat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// page.avif and page.jxl hold only their format's signature; they are
+// handed to a stub converter that writes page.png, so the tests need no
+// AVIF or JPEG XL tools installed. TestDecodeMagick runs the real
+// converter on files it encodes itself.
+var stubConverter = []string{"sh", "-c", "cat >/dev/null; cat testdata/page.png"}
+
+func TestSniff(t *testing.T) {
+	for _, tt := range []struct{ file, want string }{
+		{"page.jpg", "jpeg"},
+		{"page.png", "png"},
+		{"page.gif", "gif"},
+		{"page.webp", "webp"},
+		{"page.avif", "avif"},
+		{"page.jxl", "jxl"},
+	} {
+		raw, err := os.ReadFile("testdata/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Sniff(raw); got != tt.want {
+			t.Errorf("Sniff(%s) = %q, want %q", tt.file, got, tt.want)
+		}
+		if ready := OCRReady(raw); ready != (tt.want == "jpeg" || tt.want == "png") {
+			t.Errorf("OCRReady(%s) = %v", tt.file, ready)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, file := range []string{"page.jpg", "page.png", "page.gif", "page.webp", "page.avif", "page.jxl"} {
+		raw, err := os.ReadFile("testdata/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := Decode(raw, stubConverter)
+		if err != nil {
+			t.Errorf("Decode(%s): %v", file, err)
+			continue
+		}
+		if img.Bounds().Empty() {
+			t.Errorf("Decode(%s) is empty", file)
+		}
+	}
+}
+
+func TestDecodeMagick(t *testing.T) {
+	if !ConverterInstalled(DefaultConverter) {
+		t.Skip("magick not installed")
+	}
+	raw, err := os.ReadFile("testdata/page.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"avif", "jxl"} {
+		t.Run(format, func(t *testing.T) {
+			var encoded, stderr bytes.Buffer
+			cmd := exec.Command("magick", "png:-", format+":-")
+			cmd.Stdin = bytes.NewReader(raw)
+			cmd.Stdout = &encoded
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Skipf("magick can't write %s: %v: %s", format, err, stderr.String())
+			}
+			if got := Sniff(encoded.Bytes()); got != format {
+				t.Fatalf("Sniff = %q, want %q", got, format)
+			}
+			img, err := Decode(encoded.Bytes(), DefaultConverter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != want.Bounds() {
+				t.Errorf("bounds = %v, want %v", img.Bounds(), want.Bounds())
+			}
+		})
+	}
+}
+
+func TestConverted(t *testing.T) {
+	if got := Converted(Default); !reflect.DeepEqual(got, []string{"avif", "jxl"}) {
+		t.Errorf("Converted(Default) = %q", got)
+	}
+	if got := Converted([]string{"jpeg", "png"}); got != nil {
+		t.Errorf("Converted(jpeg, png) = %q", got)
+	}
+	if !ConverterInstalled([]string{"sh", "-c", "true"}) {
+		t.Error("sh should be installed")
+	}
+	if ConverterInstalled([]string{"no-such-converter-here"}) || ConverterInstalled(nil) {
+		t.Error("a missing converter was reported installed")
+	}
+}
+
+func TestDecodeGIFFirstFrame(t *testing.T) {
+	raw, err := os.ReadFile("testdata/page.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := Decode(raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second frame is solid black; the first has a white margin.
+	if c := color.GrayModel.Convert(img.At(0, 0)).(color.Gray); c.Y < 200 {
+		t.Errorf("corner pixel = %d, want white from the first frame", c.Y)
+	}
+}
+
+func TestDecodeConverterErrors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/page.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(raw, nil); err == nil || !strings.Contains(err.Error(), "converter") {
+		t.Errorf("Decode without a converter = %v", err)
+	}
+	if _, err := Decode(raw, []string{"sh", "-c", "echo broken >&2; exit 1"}); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Decode with a failing converter = %v, want its stderr", err)
+	}
+	if _, err := Decode(raw, []string{"sh", "-c", "cat >/dev/null; echo not an image"}); err == nil {
+		t.Error("Decode accepted converter output that isn't an image")
+	}
+}
+
+func TestSet(t *testing.T) {
+	all, err := NewSet(Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"001.jpg", "001.JPEG", "001.png", "001.webp", "001.avif", "001.gif", "001.jxl"} {
+		if !all.Match(name) {
+			t.Errorf("default set doesn't match %s", name)
+		}
+	}
+	for _, name := range []string{"notes.txt", "001.bmp", "ch1.cbz", "noextension"} {
+		if all.Match(name) {
+			t.Errorf("default set matches %s", name)
+		}
+	}
+
+	some, err := NewSet([]string{"JPEG", "webp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !some.Match("001.jpg") || !some.Match("001.webp") || some.Match("001.png") {
+		t.Errorf("set of jpeg and webp = %v", some)
+	}
+	if _, err := NewSet([]string{"bmp"}); err == nil {
+		t.Error("NewSet accepted an unknown format")
+	}
+}
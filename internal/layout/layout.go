@@ -0,0 +1,31 @@
+package layout
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"mangasearch/internal/container"
+)
+
+// Parse splits a page path into series, chapter and page, taken from the
+// last three path elements: <series>/<chapter>/<page>. Pages inside a
+// container are <series>/<chapter>.cbz/<entry>.
+func Parse(path string) (series, chapter, page string, err error) {
+	if file, entry, ok := container.Split(path); ok {
+		series = filepath.Base(filepath.Dir(file))
+		chapter = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if series == "." || series == string(filepath.Separator) {
+			return "", "", "", fmt.Errorf("path too short: %q", path)
+		}
+		return series, chapter, entry, nil
+	}
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) < 3 {
+		return "", "", "", fmt.Errorf("path too short: %q", path)
+	}
+	series = parts[len(parts)-3]
+	chapter = parts[len(parts)-2]
+	page = parts[len(parts)-1]
+	return series, chapter, page, nil
+}
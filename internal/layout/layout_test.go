@@ -0,0 +1,79 @@
+package layout
+
+import "testing"
+
+func TestTemplateMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		series  string
+		chapter string
+		page    string
+		ok      bool
+	}{
+		{"{series}/{chapter}/{page}", "Berserk/ch1/001.png", "Berserk", "ch1", "001.png", true},
+		{"{series}/{chapter}/{page}", "Berserk/Vol 01.cbz/001.png", "Berserk", "Vol 01", "001.png", true},
+		{"{series}/{chapter}/{page}", "Berserk/Vol 01.cbz/scans/001.png", "Berserk", "Vol 01", "scans/001.png", true},
+		{"{series}/Volume {chapter}/{page}", "Berserk/Volume 3.epub/7", "Berserk", "3", "7", true},
+		{"{series}/{chapter}/{page}", "Berserk/001.png", "", "", "", false},
+		{"{series}/{chapter}/{page}", "Seinen/Berserk/ch1/001.png", "", "", "", false},
+		{"*/{series}/{chapter}/{page}", "Seinen/Berserk/ch1/001.png", "Berserk", "ch1", "001.png", true},
+		{"{series}/Volume {chapter}/{page}", "Berserk/Volume 3/001.png", "Berserk", "3", "001.png", true},
+		{"{series}/Volume {chapter}/{page}", "Berserk/Vol 3/001.png", "", "", "", false},
+		{"{series} [*]/{chapter}/{page}", "Berserk [Dark Horse]/ch1/001.png", "Berserk", "ch1", "001.png", true},
+	}
+	for _, tt := range tests {
+		tmpl, err := Compile(tt.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.pattern, err)
+		}
+		series, chapter, page, ok := tmpl.Match(tt.rel)
+		if ok != tt.ok || series != tt.series || chapter != tt.chapter || page != tt.page {
+			t.Errorf("%q.Match(%q) = %q, %q, %q, %v; want %q, %q, %q, %v",
+				tt.pattern, tt.rel, series, chapter, page, ok, tt.series, tt.chapter, tt.page, tt.ok)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"{series}/{chapter}",
+		"{series}/{page}",
+		"{series}/{chapter}/{page}.png",
+		"{series}/{volume}/{page}",
+		"{series}/{series}{chapter}/{page}",
+		"{series}//{chapter}/{page}",
+		"{series/{chapter}/{page}",
+	} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestLibrariesParse(t *testing.T) {
+	flat, err := Compile("{series}/{chapter}/{page}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs := Libraries{
+		{Name: "manga", Root: "/media/manga"},
+		{Name: "comics", Root: "/media/comics", Layout: flat},
+	}
+
+	library, series, chapter, page, err := libs.Parse("/media/comics/Saga/Vol 1.cbz/01.jpg")
+	if err != nil || library != "comics" || series != "Saga" || chapter != "Vol 1" || page != "01.jpg" {
+		t.Errorf("comics page = %q, %q, %q, %q, %v", library, series, chapter, page, err)
+	}
+	library, series, _, _, err = libs.Parse("/media/manga/Seinen/Berserk/ch1/001.png")
+	if err != nil || library != "manga" || series != "Berserk" {
+		t.Errorf("manga page = %q, %q, %v", library, series, err)
+	}
+	if _, _, _, _, err := libs.Parse("/media/manga-old/Berserk/ch1/001.png"); err == nil {
+		t.Error("path outside every library parsed")
+	}
+	library, series, _, _, err = Libraries(nil).Parse("/manga/Berserk/ch1/001.png")
+	if err != nil || library != DefaultLibrary || series != "Berserk" {
+		t.Errorf("no libraries = %q, %q, %v", library, series, err)
+	}
+}
@@ -0,0 +1,67 @@
+package layout
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultLibrary names the single library of a setup that doesn't
+// configure any, and the pages indexed before libraries existed.
+const DefaultLibrary = "default"
+
+type Library struct {
+	Name string
+	Root string
+	// Layout is nil for the default of the last three path elements.
+	Layout *Template
+}
+
+// Contains reports whether path lies under the library root.
+func (l Library) Contains(path string) bool {
+	root := filepath.Clean(l.Root)
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// Parse splits a page path of this library into series, chapter and page.
+func (l Library) Parse(path string) (series, chapter, page string, err error) {
+	if l.Layout == nil {
+		return Parse(path)
+	}
+	rel, err := filepath.Rel(l.Root, path)
+	if err != nil {
+		return "", "", "", err
+	}
+	series, chapter, page, ok := l.Layout.Match(rel)
+	if !ok {
+		return "", "", "", fmt.Errorf("%q does not match layout %q of library %s", path, l.Layout, l.Name)
+	}
+	return series, chapter, page, nil
+}
+
+type Libraries []Library
+
+// Find returns the library whose root holds path.
+func (ls Libraries) Find(path string) (Library, bool) {
+	for _, l := range ls {
+		if l.Contains(path) {
+			return l, true
+		}
+	}
+	return Library{}, false
+}
+
+// Parse is Parse for the library holding path. Without any libraries every
+// path belongs to DefaultLibrary.
+func (ls Libraries) Parse(path string) (library, series, chapter, page string, err error) {
+	if len(ls) == 0 {
+		series, chapter, page, err = Parse(path)
+		return DefaultLibrary, series, chapter, page, err
+	}
+	l, ok := ls.Find(path)
+	if !ok {
+		return "", "", "", "", fmt.Errorf("%q is not inside any library", path)
+	}
+	series, chapter, page, err = l.Parse(path)
+	return l.Name, series, chapter, page, err
+}
@@ -0,0 +1,117 @@
+package layout
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mangasearch/internal/container"
+)
+
+var placeholders = []string{"series", "chapter", "page"}
+
+// Template describes where series, chapter and page sit in a path relative
+// to a library root, e.g. "{series}/Volume {chapter}/{page}". Each of
+// {series}, {chapter} and {page} appears exactly once, {page} is always the
+// whole last segment, and * matches anything within one segment. A
+// container counts as the folder holding its pages, without its extension.
+type Template struct {
+	pattern string
+	re      *regexp.Regexp
+	groups  map[string]int
+}
+
+func Compile(pattern string) (*Template, error) {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	segments := strings.Split(pattern, "/")
+	if segments[len(segments)-1] != "{page}" {
+		return nil, fmt.Errorf("layout %q: the last segment must be {page}", pattern)
+	}
+
+	t := &Template{pattern: pattern, groups: make(map[string]int)}
+	var expr strings.Builder
+	expr.WriteString("^")
+	group := 0
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("layout %q: empty segment", pattern)
+		}
+		if i > 0 {
+			expr.WriteString("/")
+		}
+		for segment != "" {
+			open := strings.IndexAny(segment, "{*")
+			if open < 0 {
+				expr.WriteString(regexp.QuoteMeta(segment))
+				break
+			}
+			expr.WriteString(regexp.QuoteMeta(segment[:open]))
+			if segment[open] == '*' {
+				expr.WriteString("[^/]*")
+				segment = segment[open+1:]
+				continue
+			}
+			end := strings.IndexByte(segment[open:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("layout %q: unclosed {", pattern)
+			}
+			name := segment[open+1 : open+end]
+			if !isPlaceholder(name) {
+				return nil, fmt.Errorf("layout %q: unknown placeholder {%s}", pattern, name)
+			}
+			if _, dup := t.groups[name]; dup {
+				return nil, fmt.Errorf("layout %q: {%s} appears twice", pattern, name)
+			}
+			group++
+			t.groups[name] = group
+			expr.WriteString("([^/]+)")
+			segment = segment[open+end+1:]
+		}
+	}
+	expr.WriteString("$")
+	for _, name := range placeholders {
+		if _, ok := t.groups[name]; !ok {
+			return nil, fmt.Errorf("layout %q: missing {%s}", pattern, name)
+		}
+	}
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("layout %q: %w", pattern, err)
+	}
+	t.re = re
+	return t, nil
+}
+
+func isPlaceholder(name string) bool {
+	for _, p := range placeholders {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) String() string {
+	return t.pattern
+}
+
+// Match parses rel, a page path relative to the library root.
+func (t *Template) Match(rel string) (series, chapter, page string, ok bool) {
+	rel = filepath.ToSlash(rel)
+	file, entry, isContainer := container.Split(rel)
+	if isContainer {
+		// entries may sit in folders of their own inside the archive
+		rel = strings.TrimSuffix(file, filepath.Ext(file)) + "/" + path.Base(entry)
+	}
+	m := t.re.FindStringSubmatch(rel)
+	if m == nil {
+		return "", "", "", false
+	}
+	page = m[t.groups["page"]]
+	if isContainer {
+		page = entry
+	}
+	return m[t.groups["series"]], m[t.groups["chapter"]], page, true
+}
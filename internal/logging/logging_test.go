@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := With(context.Background(), "worker", 2)
+	ctx = With(ctx, "job_id", "abc123")
+	log.With("component", "queue").InfoContext(ctx, "indexed", "page", "001.png")
+	log.DebugContext(ctx, "dropped below level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{"msg": "indexed", "component": "queue", "page": "001.png", "worker": float64(2), "job_id": "abc123"} {
+		if rec[key] != want {
+			t.Errorf("%s = %v, want %v", key, rec[key], want)
+		}
+	}
+}
+
+func TestWithDoesNotShareAttrs(t *testing.T) {
+	base := With(context.Background(), "worker", 1)
+	a := With(base, "job_id", "a")
+	b := With(base, "job_id", "b")
+	if got := attrsFrom(a)[1].Value.String(); got != "a" {
+		t.Errorf("first context job_id = %q, want a", got)
+	}
+	if got := attrsFrom(b)[1].Value.String(); got != "b" {
+		t.Errorf("second context job_id = %q, want b", got)
+	}
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("format xml: want error")
+	}
+	if _, err := New(&bytes.Buffer{}, "text", "loud"); err == nil {
+		t.Error("level loud: want error")
+	}
+}
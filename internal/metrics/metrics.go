@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mangasearch_queue_depth",
+		Help: "Jobs waiting in the Redis queue.",
+	})
+	JobsProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mangasearch_jobs_processed_total",
+		Help: "Pages OCR'd, saved and indexed.",
+	})
+	JobsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mangasearch_jobs_failed_total",
+		Help: "Pages that ran out of retries, by the step that failed.",
+	}, []string{"reason"})
+	OCRLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mangasearch_ocr_batch_duration_seconds",
+		Help:    "Time the OCR service took per batch request.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 10),
+	})
+	OCRBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mangasearch_ocr_batch_images",
+		Help:    "Images sent to the OCR service per batch request.",
+		Buckets: prometheus.LinearBuckets(1, 4, 8),
+	})
+	IndexLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mangasearch_es_index_duration_seconds",
+		Help:    "Time to index one page into Elasticsearch.",
+		Buckets: prometheus.DefBuckets,
+	})
+	SearchLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mangasearch_search_duration_seconds",
+		Help:    "Time Elasticsearch took to answer a search that missed the cache.",
+		Buckets: prometheus.DefBuckets,
+	})
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mangasearch_search_cache_requests_total",
+		Help: "Search cache lookups by result (hit or miss).",
+	}, []string{"result"})
+	ScanDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mangasearch_watcher_scan_duration_seconds",
+		Help:    "Time the watcher took to walk the manga folder.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	FilesDiscovered = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mangasearch_watcher_files_discovered",
+		Help: "Pages found by the last watcher scan.",
+	})
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mangasearch_http_requests_total",
+		Help: "API requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mangasearch_http_request_duration_seconds",
+		Help:    "API request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		QueueDepth,
+		JobsProcessed,
+		JobsFailed,
+		OCRLatency,
+		OCRBatchSize,
+		IndexLatency,
+		SearchLatency,
+		CacheRequests,
+		ScanDuration,
+		FilesDiscovered,
+		HTTPRequests,
+		HTTPLatency,
+	)
+	// Start both at zero so the hit ratio is defined before the first search.
+	CacheRequests.WithLabelValues("hit")
+	CacheRequests.WithLabelValues("miss")
+}
+
+// Handler serves every metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,17 @@
+package natsort
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestLess(t *testing.T) {
+	got := []string{"ch10", "ch9", "Ch1", "ch2.5", "ch02", "10.png", "9.png", "009.png", "extra"}
+	sort.Slice(got, func(i, j int) bool { return Less(got[i], got[j]) })
+	want := []string{"9.png", "009.png", "10.png", "Ch1", "ch2.5", "ch02", "ch9", "ch10", "extra"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sorted = %v, want %v", got, want)
+		}
+	}
+}
@@ -2,27 +2,51 @@ package ocr
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"mangasearch/internal/logging"
 )
 
 type Client struct {
 	url             string
+	batchURL        string
+	healthURL       string
 	macPrefix       string
 	containerPrefix string
+	mu              sync.Mutex
+	engine          *Engine
+	log             *slog.Logger
 }
 
-func NewClient(port int, macPrefix, containerPrefix string) *Client {
+// NewClient talks to the OCR server at baseURL, e.g. "http://localhost:5001".
+func NewClient(baseURL, macPrefix, containerPrefix string, logger *slog.Logger) *Client {
+	baseURL = strings.TrimRight(baseURL, "/")
 	return &Client{
-		url:             fmt.Sprintf("http://127.0.0.1:%d/ocr", port),
+		url:             baseURL + "/ocr",
+		batchURL:        baseURL + "/ocr/batch",
+		healthURL:       baseURL + "/health",
 		macPrefix:       macPrefix,
 		containerPrefix: containerPrefix,
+		log:             logging.OrDefault(logger).With("component", "ocr"),
 	}
 }
 
+// Engine identifies the OCR backend so cached results can be invalidated
+// when it is upgraded.
+type Engine struct {
+	Name    string `json:"engine"`
+	Version string `json:"version"`
+}
+
 type request struct {
 	Path string `json:"path"`
 }
@@ -31,6 +55,83 @@ type response struct {
 	Text string `json:"text"`
 }
 
+type BatchItem struct {
+	ID       string
+	Path     string
+	Image    []byte
+	Settings Settings
+}
+
+type BatchResult struct {
+	ID        string
+	Text      string
+	Fragments []Fragment
+	Err       error
+}
+
+// Fragment is one piece of detected text and its bounding box in pixels.
+type Fragment struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	X0         float64 `json:"x0"`
+	Y0         float64 `json:"y0"`
+	X1         float64 `json:"x1"`
+	Y1         float64 `json:"y1"`
+}
+
+type fragmentResponse struct {
+	Text       string     `json:"text"`
+	Confidence float64    `json:"confidence"`
+	Box        [4]float64 `json:"box"`
+}
+
+type batchRequestItem struct {
+	ID        string   `json:"id"`
+	Path      string   `json:"path,omitempty"`
+	Image     []byte   `json:"image,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+}
+
+type batchRequest struct {
+	Items []batchRequestItem `json:"items"`
+}
+
+type batchResponse struct {
+	Results []struct {
+		ID        string             `json:"id"`
+		Text      string             `json:"text"`
+		Fragments []fragmentResponse `json:"fragments"`
+		Error     string             `json:"error"`
+	} `json:"results"`
+}
+
+// Engine asks the server which engine and version it runs. The answer is
+// remembered once the server has reported it.
+func (c *Client) Engine() (Engine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.engine != nil {
+		return *c.engine, nil
+	}
+
+	resp, err := http.Get(c.healthURL)
+	if err != nil {
+		return Engine{}, err
+	}
+	defer resp.Body.Close()
+
+	var engine Engine
+	if err := json.NewDecoder(resp.Body).Decode(&engine); err != nil {
+		return Engine{}, fmt.Errorf("failed to parse health response: %w", err)
+	}
+	if engine.Name == "" || engine.Version == "" {
+		return Engine{}, errors.New("ocr server did not report its engine version")
+	}
+	c.engine = &engine
+	return engine, nil
+}
+
 func (c *Client) translatePath(path string) string {
 	return strings.Replace(path, c.macPrefix, c.containerPrefix, 1)
 }
@@ -59,3 +160,81 @@ func (c *Client) GetData(pathName string) (string, error) {
 	}
 	return result.Text, nil
 }
+
+// GetBatch returns one result per item, in input order. Items carrying Image
+// are sent inline; the rest are read by the server from Path. Per-item failures
+// are reported in BatchResult.Err; a non-nil error fails the whole batch.
+func (c *Client) GetBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	began := time.Now()
+	req := batchRequest{Items: make([]batchRequestItem, 0, len(items))}
+	for _, item := range items {
+		reqItem := batchRequestItem{
+			ID:        item.ID,
+			Image:     item.Image,
+			Languages: item.Settings.Languages,
+			Direction: item.Settings.Direction,
+		}
+		if item.Image == nil {
+			reqItem.Path = c.translatePath(item.Path)
+		}
+		req.Items = append(req.Items, reqItem)
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.batchURL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.log.DebugContext(ctx, "ocr batch", "images", len(items), "status", resp.StatusCode, "took", time.Since(began))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("batch request failed: %d %s", resp.StatusCode, string(body))
+	}
+
+	var parsed batchResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse batch response: %w", err)
+	}
+
+	byID := make(map[string]BatchResult, len(parsed.Results))
+	for _, r := range parsed.Results {
+		res := BatchResult{ID: r.ID, Text: r.Text}
+		for _, f := range r.Fragments {
+			res.Fragments = append(res.Fragments, Fragment{
+				Text:       f.Text,
+				Confidence: f.Confidence,
+				X0:         f.Box[0],
+				Y0:         f.Box[1],
+				X1:         f.Box[2],
+				Y1:         f.Box[3],
+			})
+		}
+		if r.Error != "" {
+			res.Err = errors.New(r.Error)
+		}
+		byID[r.ID] = res
+	}
+
+	results := make([]BatchResult, len(items))
+	for i, item := range items {
+		res, ok := byID[item.ID]
+		if !ok {
+			res = BatchResult{ID: item.ID, Err: fmt.Errorf("no result returned for %s", item.ID)}
+		}
+		results[i] = res
+	}
+	return results, nil
+}
@@ -0,0 +1,110 @@
+package ocr
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"mangasearch/internal/logging"
+)
+
+// SidecarName is the per-series settings file looked up in the series folder.
+const SidecarName = "mangasearch.json"
+
+type Settings struct {
+	Languages []string `json:"languages"`
+	Direction string   `json:"direction"`
+}
+
+// Key is the value stored with each page, e.g. "ja+en".
+func (s Settings) Key() string {
+	return strings.Join(s.Languages, "+")
+}
+
+type sidecar struct {
+	modTime  time.Time
+	settings *Settings
+}
+
+// Resolver picks the OCR settings for a series. A sidecar file in the series
+// folder wins over the configured per-series mapping, which wins over the
+// series' library, which wins over the defaults.
+type Resolver struct {
+	defaults   Settings
+	perLibrary map[string]Settings
+	perSeries  map[string]Settings
+	mu         sync.Mutex
+	sidecars   map[string]sidecar
+	log        *slog.Logger
+}
+
+func NewResolver(defaults Settings, perLibrary, perSeries map[string]Settings, logger *slog.Logger) *Resolver {
+	if perLibrary == nil {
+		perLibrary = make(map[string]Settings)
+	}
+	if perSeries == nil {
+		perSeries = make(map[string]Settings)
+	}
+	return &Resolver{
+		defaults:   defaults,
+		perLibrary: perLibrary,
+		perSeries:  perSeries,
+		sidecars:   make(map[string]sidecar),
+		log:        logging.OrDefault(logger).With("component", "ocr"),
+	}
+}
+
+func (r *Resolver) For(library, series, seriesDir string) Settings {
+	settings := r.defaults
+	if s, ok := r.perLibrary[library]; ok {
+		settings = merge(settings, s)
+	}
+	if s, ok := r.perSeries[series]; ok {
+		settings = merge(settings, s)
+	}
+	if s := r.loadSidecar(seriesDir); s != nil {
+		settings = merge(settings, *s)
+	}
+	return settings
+}
+
+func (r *Resolver) loadSidecar(dir string) *Settings {
+	path := filepath.Join(dir, SidecarName)
+	info, err := os.Stat(path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		delete(r.sidecars, dir)
+		return nil
+	}
+	if cached, ok := r.sidecars[dir]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.settings
+	}
+
+	var settings *Settings
+	if data, err := os.ReadFile(path); err == nil {
+		var s Settings
+		if err := json.Unmarshal(data, &s); err == nil {
+			settings = &s
+		} else {
+			r.log.Warn("ignoring sidecar", "path", path, "error", err)
+		}
+	}
+	r.sidecars[dir] = sidecar{modTime: info.ModTime(), settings: settings}
+	return settings
+}
+
+func merge(base, override Settings) Settings {
+	if len(override.Languages) > 0 {
+		base.Languages = override.Languages
+	}
+	if override.Direction != "" {
+		base.Direction = override.Direction
+	}
+	return base
+}
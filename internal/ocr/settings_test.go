@@ -0,0 +1,58 @@
+package ocr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolverFor(t *testing.T) {
+	root := t.TempDir()
+	withSidecar := filepath.Join(root, "Vagabond")
+	if err := os.MkdirAll(withSidecar, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := `{"languages": ["ja"], "direction": "vertical"}`
+	if err := os.WriteFile(filepath.Join(withSidecar, SidecarName), []byte(sidecar), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver(
+		Settings{Languages: []string{"en"}, Direction: "horizontal"},
+		map[string]Settings{
+			"raw": {Languages: []string{"ja"}, Direction: "vertical"},
+		},
+		map[string]Settings{
+			"Berserk":  {Languages: []string{"en", "fr"}},
+			"Vagabond": {Languages: []string{"en"}},
+		},
+		nil,
+	)
+
+	tests := []struct {
+		name    string
+		library string
+		series  string
+		dir     string
+		wantKey string
+		wantDir string
+	}{
+		{"defaults", "default", "OnePiece", filepath.Join(root, "OnePiece"), "en", "horizontal"},
+		{"library", "raw", "OnePiece", filepath.Join(root, "OnePiece"), "ja", "vertical"},
+		{"config mapping", "default", "Berserk", filepath.Join(root, "Berserk"), "en+fr", "horizontal"},
+		{"mapping wins over library", "raw", "Berserk", filepath.Join(root, "Berserk"), "en+fr", "vertical"},
+		{"sidecar wins over mapping", "default", "Vagabond", withSidecar, "ja", "vertical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.For(tt.library, tt.series, tt.dir)
+			if got.Key() != tt.wantKey {
+				t.Errorf("languages: got %q, want %q", got.Key(), tt.wantKey)
+			}
+			if got.Direction != tt.wantDir {
+				t.Errorf("direction: got %q, want %q", got.Direction, tt.wantDir)
+			}
+		})
+	}
+}
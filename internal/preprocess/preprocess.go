@@ -0,0 +1,216 @@
+package preprocess
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"mangasearch/internal/container"
+	"mangasearch/internal/imageformat"
+
+	"golang.org/x/image/draw"
+)
+
+type Options struct {
+	SplitSpreads    bool
+	SpreadRatio     float64
+	RightToLeft     bool
+	TrimBorders     bool
+	TrimTolerance   uint8
+	Grayscale       bool
+	UpscaleMinWidth int
+	// Converter turns AVIF and JPEG XL pages into PNG; see
+	// imageformat.Decode.
+	Converter []string
+}
+
+type Pipeline struct {
+	opts Options
+}
+
+func New(opts Options) *Pipeline {
+	if opts.SpreadRatio <= 0 {
+		opts.SpreadRatio = 1.2
+	}
+	return &Pipeline{opts: opts}
+}
+
+func (p *Pipeline) enabled() bool {
+	return p.opts.SplitSpreads || p.opts.TrimBorders || p.opts.Grayscale || p.opts.UpscaleMinWidth > 0
+}
+
+// Process reads the image at path and returns one PNG per logical page, in
+// reading order. With every step disabled a JPEG or PNG is passed through
+// untouched; other formats are converted to PNG for the OCR engine.
+func (p *Pipeline) Process(path string) ([][]byte, error) {
+	raw, err := container.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("preprocess read: %w", err)
+	}
+	if !p.enabled() && imageformat.OCRReady(raw) {
+		return [][]byte{raw}, nil
+	}
+
+	img, err := imageformat.Decode(raw, p.opts.Converter)
+	if err != nil {
+		return nil, fmt.Errorf("preprocess decode: %w", err)
+	}
+
+	pages := []image.Image{img}
+	if p.enabled() {
+		pages = p.Run(img)
+	}
+	out := make([][]byte, 0, len(pages))
+	for _, page := range pages {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, page); err != nil {
+			return nil, fmt.Errorf("preprocess encode: %w", err)
+		}
+		out = append(out, buf.Bytes())
+	}
+	return out, nil
+}
+
+// Run applies the enabled steps: trim, split, grayscale, upscale.
+func (p *Pipeline) Run(img image.Image) []image.Image {
+	if p.opts.TrimBorders {
+		img = trim(img, p.opts.TrimTolerance)
+	}
+
+	pages := []image.Image{img}
+	if p.opts.SplitSpreads && isSpread(img, p.opts.SpreadRatio) {
+		pages = split(img, p.opts.RightToLeft)
+		if p.opts.TrimBorders {
+			for i := range pages {
+				pages[i] = trim(pages[i], p.opts.TrimTolerance)
+			}
+		}
+	}
+
+	for i := range pages {
+		if p.opts.Grayscale {
+			pages[i] = grayscale(pages[i])
+		}
+		if p.opts.UpscaleMinWidth > 0 {
+			pages[i] = upscale(pages[i], p.opts.UpscaleMinWidth)
+		}
+	}
+	return pages
+}
+
+func isSpread(img image.Image, ratio float64) bool {
+	b := img.Bounds()
+	if b.Dy() == 0 {
+		return false
+	}
+	return float64(b.Dx())/float64(b.Dy()) >= ratio
+}
+
+// split cuts a spread down the middle. Right-to-left books are read right
+// half first, so that half comes back first.
+func split(img image.Image, rightToLeft bool) []image.Image {
+	b := img.Bounds()
+	mid := b.Min.X + b.Dx()/2
+	left := crop(img, image.Rect(b.Min.X, b.Min.Y, mid, b.Max.Y))
+	right := crop(img, image.Rect(mid, b.Min.Y, b.Max.X, b.Max.Y))
+	if rightToLeft {
+		return []image.Image{right, left}
+	}
+	return []image.Image{left, right}
+}
+
+// trim removes uniform white or black borders. The background is taken from
+// the top-left pixel and only trimmed if it is close to pure white or black.
+func trim(img image.Image, tolerance uint8) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+	bg := luma(img.At(b.Min.X, b.Min.Y))
+	if bg > tolerance && bg < 255-tolerance {
+		return img
+	}
+
+	isBorder := func(x, y int) bool {
+		return absDiff(luma(img.At(x, y)), bg) <= tolerance
+	}
+	rowBlank := func(y int) bool {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	colBlank := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	minY, maxY := b.Min.Y, b.Max.Y
+	for minY < maxY && rowBlank(minY) {
+		minY++
+	}
+	for maxY > minY && rowBlank(maxY-1) {
+		maxY--
+	}
+	if minY == maxY {
+		return img
+	}
+	minX, maxX := b.Min.X, b.Max.X
+	for minX < maxX && colBlank(minX, minY, maxY) {
+		minX++
+	}
+	for maxX > minX && colBlank(maxX-1, minY, maxY) {
+		maxX--
+	}
+	return crop(img, image.Rect(minX, minY, maxX, maxY))
+}
+
+func grayscale(img image.Image) image.Image {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+	return gray
+}
+
+func upscale(img image.Image, minWidth int) image.Image {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dx() >= minWidth {
+		return img
+	}
+	height := b.Dy() * minWidth / b.Dx()
+	rect := image.Rect(0, 0, minWidth, height)
+
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	draw.CatmullRom.Scale(dst, rect, img, b, draw.Src, nil)
+	return dst
+}
+
+func crop(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+func luma(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,186 @@
+package preprocess
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata/golden")
+
+func TestPipelineGolden(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      Options
+		wantPages int
+	}{
+		{
+			name:      "spread_rtl",
+			input:     "spread.png",
+			opts:      Options{SplitSpreads: true, RightToLeft: true},
+			wantPages: 2,
+		},
+		{
+			name:      "spread_ltr_trimmed",
+			input:     "spread.png",
+			opts:      Options{SplitSpreads: true, TrimBorders: true, TrimTolerance: 16},
+			wantPages: 2,
+		},
+		{
+			name:      "spread_disabled",
+			input:     "spread.png",
+			opts:      Options{},
+			wantPages: 1,
+		},
+		{
+			name:      "white_border",
+			input:     "white_border.png",
+			opts:      Options{TrimBorders: true, TrimTolerance: 16},
+			wantPages: 1,
+		},
+		{
+			name:      "black_border_gray",
+			input:     "black_border.png",
+			opts:      Options{TrimBorders: true, TrimTolerance: 16, Grayscale: true},
+			wantPages: 1,
+		},
+		{
+			name:      "small_upscaled",
+			input:     "small.png",
+			opts:      Options{Grayscale: true, UpscaleMinWidth: 120},
+			wantPages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := New(tt.opts).Run(readPNG(t, filepath.Join("testdata", tt.input)))
+			if len(pages) != tt.wantPages {
+				t.Fatalf("pages: got %d, want %d", len(pages), tt.wantPages)
+			}
+
+			for i, page := range pages {
+				golden := filepath.Join("testdata", "golden", fmt.Sprintf("%s_%d.png", tt.name, i))
+				if *update {
+					writePNG(t, golden, page)
+					continue
+				}
+				want := readPNG(t, golden)
+				if diff := compare(page, want); diff != "" {
+					t.Errorf("page %d does not match %s: %s", i, golden, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestIsSpread(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+		want bool
+	}{
+		{"portrait page", 800, 1200, false},
+		{"square scan", 1000, 1000, false},
+		{"double page", 1600, 1200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewGray(image.Rect(0, 0, tt.w, tt.h))
+			if got := isSpread(img, 1.2); got != tt.want {
+				t.Errorf("isSpread(%dx%d) = %v, want %v", tt.w, tt.h, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessFormats(t *testing.T) {
+	fixtures := filepath.Join("..", "imageformat", "testdata")
+	// AVIF and JPEG XL go through the converter, stubbed to emit page.png.
+	converter := []string{"sh", "-c", "cat >/dev/null; cat " + filepath.Join(fixtures, "page.png")}
+	want := readPNG(t, filepath.Join(fixtures, "page.png"))
+
+	for _, file := range []string{"page.png", "page.jpg", "page.gif", "page.webp", "page.avif", "page.jxl"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(fixtures, file)
+			pages, err := New(Options{Converter: converter}).Process(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != 1 {
+				t.Fatalf("pages: got %d, want 1", len(pages))
+			}
+			raw, _ := os.ReadFile(path)
+			switch file {
+			case "page.png", "page.jpg":
+				if !bytes.Equal(pages[0], raw) {
+					t.Error("JPEG and PNG should pass through untouched")
+				}
+				return
+			}
+			img, err := png.Decode(bytes.NewReader(pages[0]))
+			if err != nil {
+				t.Fatalf("not converted to PNG: %v", err)
+			}
+			if file == "page.webp" {
+				return
+			}
+			if diff := compare(img, want); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func compare(got, want image.Image) string {
+	gb, wb := got.Bounds(), want.Bounds()
+	if gb.Dx() != wb.Dx() || gb.Dy() != wb.Dy() {
+		return fmt.Sprintf("size %dx%d, want %dx%d", gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy())
+	}
+	for y := 0; y < gb.Dy(); y++ {
+		for x := 0; x < gb.Dx(); x++ {
+			r1, g1, b1, a1 := got.At(gb.Min.X+x, gb.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := want.At(wb.Min.X+x, wb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return fmt.Sprintf("pixel (%d,%d) differs", x, y)
+			}
+		}
+	}
+	return ""
+}
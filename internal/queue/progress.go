@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const throughputWindow = 5 * time.Minute
+
+// SeriesKey names a series within its library; two libraries can each
+// have a series of the same name.
+type SeriesKey struct {
+	Library string
+	Series  string
+}
+
+type WorkerActivity struct {
+	ID    int       `json:"id"`
+	Paths []string  `json:"paths"`
+	Since time.Time `json:"since"`
+}
+
+// progress tracks what this process has queued and is working on. Jobs left
+// in Redis by an earlier run are only counted once a worker picks them up.
+type progress struct {
+	mu      sync.Mutex
+	pending map[SeriesKey]int
+	active  map[int]WorkerActivity
+	done    []time.Time
+}
+
+func newProgress() *progress {
+	return &progress{
+		pending: make(map[SeriesKey]int),
+		active:  make(map[int]WorkerActivity),
+	}
+}
+
+func (p *progress) queued(series SeriesKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[series]++
+}
+
+func (p *progress) finished(series SeriesKey, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[series] > 1 {
+		p.pending[series]--
+	} else {
+		delete(p.pending, series)
+	}
+	p.done = append(p.done, at)
+	p.trim(at)
+}
+
+func (p *progress) start(worker int, paths []string, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active[worker] = WorkerActivity{ID: worker, Paths: paths, Since: at}
+}
+
+func (p *progress) stop(worker int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, worker)
+}
+
+func (p *progress) pendingBySeries() map[SeriesKey]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[SeriesKey]int, len(p.pending))
+	for series, n := range p.pending {
+		out[series] = n
+	}
+	return out
+}
+
+func (p *progress) workers() []WorkerActivity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]WorkerActivity, 0, len(p.active))
+	for _, a := range p.active {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// throughput is pages finished per minute over the last few minutes.
+func (p *progress) throughput(now time.Time) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trim(now)
+	if len(p.done) == 0 {
+		return 0
+	}
+	window := min(now.Sub(p.done[0]), throughputWindow)
+	if window < time.Minute {
+		window = time.Minute
+	}
+	return float64(len(p.done)) / window.Minutes()
+}
+
+func (p *progress) trim(now time.Time) {
+	cutoff := now.Add(-throughputWindow)
+	i := 0
+	for i < len(p.done) && p.done[i].Before(cutoff) {
+		i++
+	}
+	p.done = p.done[i:]
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	berserk := SeriesKey{"manga", "Berserk"}
+	vagabond := SeriesKey{"manga", "Vagabond"}
+	otherBerserk := SeriesKey{"scans", "Berserk"}
+	p := newProgress()
+	p.queued(berserk)
+	p.queued(berserk)
+	p.queued(vagabond)
+	p.queued(otherBerserk)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p.start(1, []string{"/manga/Berserk/ch1/001.png"}, start)
+	if got := p.workers(); len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("workers = %+v", got)
+	}
+
+	p.finished(berserk, start.Add(30*time.Second))
+	p.finished(vagabond, start.Add(time.Minute))
+	p.stop(1)
+
+	pending := p.pendingBySeries()
+	if pending[berserk] != 1 {
+		t.Errorf("Berserk pending = %d, want 1", pending[berserk])
+	}
+	if pending[otherBerserk] != 1 {
+		t.Errorf("Berserk in another library pending = %d, want 1", pending[otherBerserk])
+	}
+	if _, ok := pending[vagabond]; ok {
+		t.Errorf("Vagabond should have no pending pages")
+	}
+	if got := p.workers(); len(got) != 0 {
+		t.Errorf("workers = %+v, want none", got)
+	}
+
+	if got := p.throughput(start.Add(150 * time.Second)); got != 1 {
+		t.Errorf("throughput = %v, want 1", got)
+	}
+	if got := p.throughput(start.Add(time.Hour)); got != 0 {
+		t.Errorf("throughput after window = %v, want 0", got)
+	}
+}
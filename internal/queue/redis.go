@@ -2,16 +2,28 @@ package queue
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"mangasearch/internal/db"
+	"mangasearch/internal/layout"
+	"mangasearch/internal/events"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/metrics"
 	"mangasearch/internal/ocr"
+	"mangasearch/internal/preprocess"
 	"mangasearch/internal/search"
+	"mangasearch/internal/textblock"
 	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const batchPollInterval = 50 * time.Millisecond
+
 type RedisQueue struct {
 	client        *redis.Client
 	ctx           context.Context
@@ -21,30 +33,124 @@ type RedisQueue struct {
 	workerCounter int
 	queueName     string
 	retries       int
+	batchSize     int
+	batchWait     time.Duration
+	libraries     layout.Libraries
 	db            *db.DB
 	es            *search.Client
 	ocr           *ocr.Client
+	pipeline      *preprocess.Pipeline
+	resolver      *ocr.Resolver
+	blockOpts     textblock.Options
+	progress      *progress
+	events        *events.Bus
+	log           *slog.Logger
+}
+
+// RedisOptions parses a redis://, rediss:// (TLS) or unix:// URL. A
+// non-empty password replaces the one in the URL, so it needn't be
+// URL-encoded.
+func RedisOptions(url, password string) (*redis.Options, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("redis url: %w", err)
+	}
+	if password != "" {
+		opts.Password = password
+	}
+	return opts, nil
 }
 
-func NewRedisQueue(workers int, redisAddr string, database *db.DB, esClient *search.Client, ocrClient *ocr.Client) *RedisQueue {
+func NewRedisQueue(workers, batchSize int, batchWait time.Duration, redisOpts *redis.Options, libs layout.Libraries, database *db.DB, esClient *search.Client, ocrClient *ocr.Client, pipeline *preprocess.Pipeline, resolver *ocr.Resolver, blockOpts textblock.Options, bus *events.Bus, logger *slog.Logger) *RedisQueue {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	return &RedisQueue{
-		client: redis.NewClient(&redis.Options{
-			Addr: redisAddr,
-			DB:   0,
-		}),
+		client:     redis.NewClient(redisOpts),
 		ctx:        context.Background(),
 		mu:         &sync.Mutex{},
 		maxWorkers: workers,
 		queueName:  "ocr_queue",
 		retries:    3,
+		batchSize:  batchSize,
+		batchWait:  batchWait,
+		libraries:  libs,
 		db:         database,
 		es:         esClient,
 		ocr:        ocrClient,
+		pipeline:   pipeline,
+		resolver:   resolver,
+		blockOpts:  blockOpts,
+		progress:   newProgress(),
+		events:     bus,
+		log:        logging.OrDefault(logger).With("component", "queue"),
 	}
 }
 
+// Job is what sits in the Redis list. ID follows the job through every log
+// line. NoCache forces a fresh OCR run even when the image has been seen
+// before.
+type Job struct {
+	ID      string `json:"id,omitempty"`
+	Path    string `json:"path"`
+	NoCache bool   `json:"no_cache,omitempty"`
+	// DiscardCorrection drops any human correction of the page once it is
+	// re-OCR'd. Without it the correction stays in front of the new text.
+	DiscardCorrection bool `json:"discard_correction,omitempty"`
+}
+
+func decodeJob(payload string) Job {
+	var job Job
+	if err := json.Unmarshal([]byte(payload), &job); err != nil || job.Path == "" {
+		// entries queued before jobs were JSON are bare paths
+		return Job{Path: payload}
+	}
+	return job
+}
+
+func newJobID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (queue *RedisQueue) Push(dataPath string) error {
-	return queue.client.RPush(queue.ctx, queue.queueName, dataPath).Err()
+	return queue.PushJob(Job{Path: dataPath})
+}
+
+func (queue *RedisQueue) PushJob(job Job) error {
+	if job.ID == "" {
+		job.ID = newJobID()
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := queue.client.RPush(queue.ctx, queue.queueName, payload).Err(); err != nil {
+		return err
+	}
+	if library, series, _, _, err := parsePath(queue.libraries, job.Path); err == nil {
+		queue.progress.queued(SeriesKey{library, series})
+	}
+	queue.events.Publish(events.Event{Type: events.PageQueued, Path: job.Path})
+	queue.log.Debug("queued", "job_id", job.ID, "path", job.Path)
+	return nil
+}
+
+// Pending is the number of queued pages per series that no worker has
+// finished yet.
+func (queue *RedisQueue) Pending() map[SeriesKey]int {
+	return queue.progress.pendingBySeries()
+}
+
+// Workers lists what each busy worker is processing and since when.
+func (queue *RedisQueue) Workers() []WorkerActivity {
+	return queue.progress.workers()
+}
+
+// Throughput is pages finished per minute, averaged over recent minutes.
+func (queue *RedisQueue) Throughput() float64 {
+	return queue.progress.throughput(time.Now())
 }
 
 func (queue *RedisQueue) QueueLength() (int, error) {
@@ -57,6 +163,7 @@ func (queue *RedisQueue) QueueLength() (int, error) {
 
 func (queue *RedisQueue) worker(id int, wg *sync.WaitGroup) {
 	defer wg.Done()
+	ctx := logging.With(queue.ctx, "worker", id)
 	defer func() {
 		queue.mu.Lock()
 		queue.activeWorkers--
@@ -69,23 +176,114 @@ func (queue *RedisQueue) worker(id int, wg *sync.WaitGroup) {
 			return
 		}
 		if err != nil {
-			fmt.Printf("[worker %d] error: %v\n", id, err)
+			queue.log.ErrorContext(ctx, "redis pop failed", "error", err)
 			return
 		}
 
-		dataPath := result[1]
-		for idx := 0; idx < queue.retries; idx++ {
-			if process(dataPath, queue.db, queue.es, queue.ocr, id) == nil {
-				break
+		batch := collectBatch(result[1], queue.batchSize, queue.batchWait, queue.popUpTo)
+		pending := make([]Job, 0, len(batch))
+		for _, payload := range batch {
+			job := decodeJob(payload)
+			if job.ID == "" {
+				// queued before jobs had IDs
+				job.ID = newJobID()
 			}
+			pending = append(pending, job)
 		}
+		paths := make([]string, 0, len(pending))
+		for _, job := range pending {
+			paths = append(paths, job.Path)
+		}
+		queue.progress.start(id, paths, time.Now())
+
+		var lastErrs []error
+		for idx := 0; idx < queue.retries && len(pending) > 0; idx++ {
+			errs := processBatch(ctx, pending, queue.libraries, queue.db, queue.es, queue.ocr, queue.pipeline, queue.resolver, queue.blockOpts, queue.events, queue.log, id)
+			var failed []Job
+			lastErrs = lastErrs[:0]
+			for i, err := range errs {
+				if err == nil {
+					metrics.JobsProcessed.Inc()
+					continue
+				}
+				queue.log.WarnContext(ctx, "job failed", "job_id", pending[i].ID, "path", pending[i].Path, "attempt", idx+1, "of", queue.retries, "error", err)
+				failed = append(failed, pending[i])
+				lastErrs = append(lastErrs, err)
+			}
+			pending = failed
+		}
+		for i, job := range pending {
+			queue.markFailed(ctx, job, lastErrs[i], id)
+		}
+
+		now := time.Now()
+		for _, path := range paths {
+			if library, series, _, _, err := parsePath(queue.libraries, path); err == nil {
+				queue.progress.finished(SeriesKey{library, series}, now)
+			}
+		}
+		queue.progress.stop(id)
 	}
 }
 
+func (queue *RedisQueue) markFailed(ctx context.Context, job Job, reason error, id int) {
+	ctx = logging.With(ctx, "job_id", job.ID, "path", job.Path)
+	metrics.JobsFailed.WithLabelValues(failureReason(reason)).Inc()
+	queue.log.ErrorContext(ctx, "giving up on job", "reason", failureReason(reason), "error", reason)
+	queue.events.Publish(events.Event{Type: events.PageFailed, Path: job.Path, Worker: id, Error: reason.Error()})
+	library, series, chapter, page, err := parsePath(queue.libraries, job.Path)
+	if err != nil {
+		return
+	}
+	p := db.Page{Path: job.Path, Library: library, Series: series, Chapter: chapter, Page: page}
+	if err := queue.db.MarkPageFailed(ctx, p, reason.Error()); err != nil {
+		queue.log.ErrorContext(ctx, "could not record failure", "error", err)
+	}
+}
+
+func (queue *RedisQueue) popUpTo(n int) ([]string, error) {
+	paths, err := queue.client.RPopCount(queue.ctx, queue.queueName, n).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return paths, err
+}
+
+// collectBatch starts a batch with first and keeps pulling from pop until the
+// batch holds size jobs or wait has elapsed, whichever comes first.
+func collectBatch(first string, size int, wait time.Duration, pop func(n int) ([]string, error)) []string {
+	batch := []string{first}
+	deadline := time.Now().Add(wait)
+	for len(batch) < size {
+		paths, err := pop(size - len(batch))
+		if err != nil {
+			break
+		}
+		batch = append(batch, paths...)
+		if len(batch) >= size {
+			break
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		time.Sleep(min(batchPollInterval, remaining))
+	}
+	return batch
+}
+
 func (queue *RedisQueue) Start(paths []string) {
+	jobs := make([]Job, 0, len(paths))
 	for _, path := range paths {
-		if err := queue.Push(path); err != nil {
-			fmt.Println("push error:", err)
+		jobs = append(jobs, Job{Path: path})
+	}
+	queue.StartJobs(jobs)
+}
+
+func (queue *RedisQueue) StartJobs(jobs []Job) {
+	for _, job := range jobs {
+		if err := queue.PushJob(job); err != nil {
+			queue.log.Error("push failed", "path", job.Path, "error", err)
 		}
 	}
 
@@ -101,7 +299,7 @@ func (queue *RedisQueue) Start(paths []string) {
 	}
 
 	wg.Wait()
-	fmt.Println("all done")
+	queue.log.Info("queue drained")
 }
 
 func (queue *RedisQueue) getActiveWorkers() int {
@@ -119,11 +317,14 @@ func (queue *RedisQueue) CacheGet(query string) (string, bool) {
 	key := "cache:" + query
 	val, err := queue.client.Get(queue.ctx, key).Result()
 	if err == redis.Nil {
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
 		return "", false
 	}
 	if err != nil {
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
 		return "", false
 	}
+	metrics.CacheRequests.WithLabelValues("hit").Inc()
 	return val, true
 }
 
@@ -131,3 +332,19 @@ func (queue *RedisQueue) CacheSet(query string, value string) {
 	key := "cache:" + query
 	queue.client.Set(queue.ctx, key, value, 5*time.Minute)
 }
+
+// CacheClear drops every cached search, for when indexed text changes.
+func (queue *RedisQueue) CacheClear() {
+	iter := queue.client.Scan(queue.ctx, 0, "cache:*", 100).Iterator()
+	var keys []string
+	for iter.Next(queue.ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		queue.log.Warn("cache clear failed", "error", err)
+		return
+	}
+	if len(keys) > 0 {
+		queue.client.Del(queue.ctx, keys...)
+	}
+}
@@ -2,47 +2,269 @@ package queue
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"path/filepath"
 	"strings"
+	"time"
+	"mangasearch/internal/container"
 	"mangasearch/internal/db"
+	"mangasearch/internal/events"
+	"mangasearch/internal/layout"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/metrics"
 	"mangasearch/internal/ocr"
+	"mangasearch/internal/preprocess"
 	"mangasearch/internal/search"
+	"mangasearch/internal/textblock"
 )
 
-func parsePath(path string) (series, chapter, page string, err error) {
-	parts := strings.Split(filepath.ToSlash(path), "/")
-	if len(parts) < 3 {
-		return "", "", "", fmt.Errorf("path too short: %q", path)
+func parsePath(libs layout.Libraries, path string) (library, series, chapter, page string, err error) {
+	return libs.Parse(path)
+}
+
+// seriesDir is the folder holding a series' chapters, where its OCR sidecar lives.
+func seriesDir(path string) string {
+	if file, _, ok := container.Split(path); ok {
+		return filepath.Dir(file)
+	}
+	return filepath.Dir(filepath.Dir(path))
+}
+
+// processBatch preprocesses every job into its logical pages, answers what
+// it can from the OCR cache, OCRs the rest in one request, then saves and
+// indexes each file on its own. The returned slice has one entry per job;
+// nil means that file is done.
+func processBatch(ctx context.Context, jobs []Job, libs layout.Libraries, database *db.DB, esClient *search.Client, ocrClient *ocr.Client, pipeline *preprocess.Pipeline, resolver *ocr.Resolver, blockOpts textblock.Options, bus *events.Bus, log *slog.Logger, id int) []error {
+	errs := make([]error, len(jobs))
+	jobCtx := make([]context.Context, len(jobs))
+	for i, job := range jobs {
+		jobCtx[i] = logging.With(ctx, "job_id", job.ID, "path", job.Path)
+	}
+	settings := make([]ocr.Settings, len(jobs))
+	var items []ocr.BatchItem
+	owner := make(map[string]int)
+	itemCount := make([]int, len(jobs))
+
+	// Without an engine version a cached result can't be trusted, so the
+	// cache is skipped entirely until the server reports one.
+	engine, engineErr := ocrClient.Engine()
+	if engineErr != nil {
+		log.WarnContext(ctx, "ocr cache disabled", "error", engineErr)
+	}
+	keys := make(map[string]db.OCRCacheKey)
+	cached := make(map[string]ocr.BatchResult)
+
+	for i, job := range jobs {
+		library, series, _, _, err := parsePath(libs, job.Path)
+		if err != nil {
+			errs[i] = failedAt("parse", fmt.Errorf("parsePath: %w", err))
+			continue
+		}
+		settings[i] = resolver.For(library, series, seriesDir(job.Path))
+		images, err := pipeline.Process(job.Path)
+		if err != nil {
+			errs[i] = failedAt("preprocess", err)
+			continue
+		}
+		for k, img := range images {
+			itemID := fmt.Sprintf("%d.%d", i, k)
+			items = append(items, ocr.BatchItem{ID: itemID, Path: job.Path, Image: img, Settings: settings[i]})
+			owner[itemID] = i
+			itemCount[i]++
+			if engineErr != nil {
+				continue
+			}
+
+			key := db.OCRCacheKey{
+				Hash:      hashImage(img),
+				Engine:    engine.Name,
+				Version:   engine.Version,
+				Languages: settings[i].Key(),
+				Direction: settings[i].Direction,
+			}
+			keys[itemID] = key
+			if job.NoCache {
+				continue
+			}
+			entry, ok, err := database.GetOCRCache(ctx, key)
+			if err != nil {
+				log.WarnContext(jobCtx[i], "ocr cache lookup failed", "error", err)
+				continue
+			}
+			if ok {
+				cached[itemID] = ocr.BatchResult{ID: itemID, Text: entry.Text, Fragments: entry.Fragments}
+			}
+		}
+	}
+	if len(items) == 0 {
+		return errs
+	}
+
+	var misses []ocr.BatchItem
+	for _, item := range items {
+		if _, ok := cached[item.ID]; !ok {
+			misses = append(misses, item)
+		}
+	}
+	for itemID := range cached {
+		log.DebugContext(jobCtx[owner[itemID]], "ocr cache hit", "item", itemID)
+	}
+
+	fetched := make(map[string]ocr.BatchResult)
+	if len(misses) > 0 {
+		started := make(map[int]bool)
+		for _, item := range misses {
+			if i := owner[item.ID]; !started[i] {
+				started[i] = true
+				bus.Publish(events.Event{Type: events.OCRStarted, Path: jobs[i].Path, Worker: id})
+			}
+		}
+		began := time.Now()
+		results, err := ocrClient.GetBatch(ctx, misses)
+		metrics.OCRLatency.Observe(time.Since(began).Seconds())
+		metrics.OCRBatchSize.Observe(float64(len(misses)))
+		if err != nil {
+			log.ErrorContext(ctx, "ocr batch failed", "images", len(misses), "error", err)
+			for _, item := range misses {
+				errs[owner[item.ID]] = failedAt("ocr", err)
+			}
+		}
+		for _, res := range results {
+			fetched[res.ID] = res
+			if key, ok := keys[res.ID]; ok && res.Err == nil {
+				entry := db.OCRCacheEntry{Text: res.Text, Fragments: res.Fragments}
+				if err := database.SaveOCRCache(ctx, key, entry); err != nil {
+					log.WarnContext(jobCtx[owner[res.ID]], "ocr cache save failed", "error", err)
+				}
+			}
+		}
+		if err == nil {
+			for _, res := range results {
+				log.InfoContext(jobCtx[owner[res.ID]], "ocr done", "item", res.ID, "fragments", len(res.Fragments))
+			}
+		}
+	}
+
+	// Items are walked in order, so the logical pages of a split spread
+	// are already in reading order here.
+	blocks := make(map[int][]textblock.Block)
+	for _, item := range items {
+		i := owner[item.ID]
+		if errs[i] != nil {
+			continue
+		}
+		res, ok := cached[item.ID]
+		if !ok {
+			res = fetched[item.ID]
+		}
+		if res.Err != nil {
+			errs[i] = failedAt("ocr", fmt.Errorf("ocr: %w", res.Err))
+			continue
+		}
+		opts := blockOpts
+		opts.Vertical = settings[i].Direction == "vertical"
+		blocks[i] = append(blocks[i], pageBlocks(res, opts)...)
+	}
+
+	for i, job := range jobs {
+		if errs[i] != nil {
+			continue
+		}
+		if itemCount[i] == 0 {
+			continue
+		}
+		for n := range blocks[i] {
+			blocks[i][n].Index = n
+		}
+		errs[i] = save(jobCtx[i], job, libs, blocks[i], settings[i].Key(), database, esClient, bus, log, id)
+	}
+	return errs
+}
+
+// stepError remembers which stage of the pipeline a job failed in, so
+// failures can be counted by reason without parsing error text.
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e *stepError) Error() string { return e.err.Error() }
+func (e *stepError) Unwrap() error { return e.err }
+
+func failedAt(step string, err error) error {
+	return &stepError{step: step, err: err}
+}
+
+func failureReason(err error) string {
+	var se *stepError
+	if errors.As(err, &se) {
+		return se.step
 	}
-	series = parts[len(parts)-3]
-	chapter = parts[len(parts)-2]
-	page = parts[len(parts)-1]
-	return series, chapter, page, nil
+	return "unknown"
 }
 
-func process(dataPath string, database *db.DB, esClient *search.Client, ocrClient *ocr.Client, id int) error {
-	series, chapter, page, err := parsePath(dataPath)
+func hashImage(img []byte) string {
+	sum := sha256.Sum256(img)
+	return hex.EncodeToString(sum[:])
+}
+
+// pageBlocks groups one logical page's fragments into text blocks. Servers
+// that send no fragments get their whole text back as a single block.
+func pageBlocks(res ocr.BatchResult, opts textblock.Options) []textblock.Block {
+	if len(res.Fragments) > 0 {
+		return textblock.Group(res.Fragments, opts)
+	}
+	if strings.TrimSpace(res.Text) == "" {
+		return nil
+	}
+	return []textblock.Block{{Text: res.Text}}
+}
+
+func save(ctx context.Context, job Job, libs layout.Libraries, blocks []textblock.Block, language string, database *db.DB, esClient *search.Client, bus *events.Bus, log *slog.Logger, id int) error {
+	library, series, chapter, page, err := parsePath(libs, job.Path)
 	if err != nil {
-		return fmt.Errorf("parsePath: %w", err)
+		return failedAt("parse", fmt.Errorf("parsePath: %w", err))
+	}
+	p := db.Page{
+		Path:     job.Path,
+		Library:  library,
+		Series:   series,
+		Chapter:  chapter,
+		Page:     page,
+		Text:     textblock.Join(blocks),
+		Language: language,
+		Blocks:   blocks,
 	}
 
-	text, err := ocrClient.GetData(dataPath)
+	p.ID, err = database.SavePage(ctx, p)
 	if err != nil {
-		fmt.Printf("[worker %d] ocr error: %v\n", id, err)
-		return err
+		return failedAt("save", fmt.Errorf("SavePage: %w", err))
 	}
-	fmt.Printf("[worker %d] OCR done — %s / %s / %s\n", id, series, chapter, page)
+	log.InfoContext(ctx, "saved", "page_id", p.ID, "library", library, "series", series, "chapter", chapter, "page", page)
 
-	if err := database.SavePage(context.Background(), series, chapter, page, dataPath, text); err != nil {
-		return fmt.Errorf("SavePage: %w", err)
+	if job.DiscardCorrection {
+		if err := database.ClearCorrection(ctx, job.Path, "re-ocr"); err != nil {
+			return failedAt("save", fmt.Errorf("ClearCorrection: %w", err))
+		}
+	}
+	correction, corrected, err := database.GetCorrection(ctx, job.Path)
+	if err != nil {
+		return failedAt("save", fmt.Errorf("GetCorrection: %w", err))
 	}
-	fmt.Printf("[worker %d] ✓ saved %s / %s / %s\n", id, series, chapter, page)
+	p.Correction, p.Corrected = correction.Text, corrected
 
-	if err := esClient.IndexPage(context.Background(), series, chapter, page, dataPath, text); err != nil {
-		return fmt.Errorf("IndexPage: %w", err)
+	began := time.Now()
+	err = esClient.IndexPage(ctx, search.DocumentFor(p))
+	metrics.IndexLatency.Observe(time.Since(began).Seconds())
+	if err != nil {
+		return failedAt("index", fmt.Errorf("IndexPage: %w", err))
 	}
-	fmt.Printf("[worker %d] ✓ indexed %s / %s / %s\n", id, series, chapter, page)
+	log.InfoContext(ctx, "indexed", "page_id", p.ID)
+	bus.Publish(events.Event{Type: events.PageIndexed, Path: job.Path, PageID: p.ID, Worker: id})
 
 	return nil
 }
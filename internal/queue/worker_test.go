@@ -1,5 +1,10 @@
 package queue
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
 
 func TestParsePath(t *testing.T) {
 	tests := []struct {
@@ -26,6 +31,22 @@ func TestParsePath(t *testing.T) {
 			wantPage:    "001.png",
 			wantErr:     false,
 		},
+		{
+			name:        "page inside an archive",
+			input:       "/manga/Berserk/Vol 01.cbz/014.jpg",
+			wantSeries:  "Berserk",
+			wantChapter: "Vol 01",
+			wantPage:    "014.jpg",
+			wantErr:     false,
+		},
+		{
+			name:        "page of a PDF volume",
+			input:       "/manga/Berserk/Vol 02.pdf/12",
+			wantSeries:  "Berserk",
+			wantChapter: "Vol 02",
+			wantPage:    "12",
+			wantErr:     false,
+		},
 		{
 			name:    "too short — only filename",
 			input:   "/014.jpg",
@@ -48,7 +69,7 @@ func TestParsePath(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			series, chapter, page, err := parsePath(tt.input)
+			_, series, chapter, page, err := parsePath(nil, tt.input)
 
 			if tt.wantErr {
 				if err == nil {
@@ -73,3 +94,95 @@ func TestParsePath(t *testing.T) {
 	}
 }
 
+func TestCollectBatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		queued []string
+		size   int
+		want   []string
+	}{
+		{
+			name:   "fills up to size",
+			queued: []string{"b", "c", "d", "e"},
+			size:   3,
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "stops when wait expires",
+			queued: []string{"b"},
+			size:   4,
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "size one never pops",
+			queued: []string{"b"},
+			size:   1,
+			want:   []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued := append([]string(nil), tt.queued...)
+			pop := func(n int) ([]string, error) {
+				n = min(n, len(queued))
+				out := queued[:n]
+				queued = queued[n:]
+				return out, nil
+			}
+
+			got := collectBatch("a", tt.size, 10*time.Millisecond, pop)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJob(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Job
+	}{
+		{
+			name:    "json job",
+			payload: `{"path":"/manga/Berserk/Chapter_057/014.jpg","no_cache":true}`,
+			want:    Job{Path: "/manga/Berserk/Chapter_057/014.jpg", NoCache: true},
+		},
+		{
+			name:    "bare path from an older queue",
+			payload: "/manga/Berserk/Chapter_057/014.jpg",
+			want:    Job{Path: "/manga/Berserk/Chapter_057/014.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeJob(tt.payload); got != tt.want {
+				t.Errorf("decodeJob(%q) = %+v, want %+v", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	ocrErr := failedAt("ocr", errors.New("connection refused"))
+	if got := failureReason(ocrErr); got != "ocr" {
+		t.Errorf("failureReason = %q, want ocr", got)
+	}
+	if ocrErr.Error() != "connection refused" {
+		t.Errorf("Error() = %q, want the wrapped message unchanged", ocrErr.Error())
+	}
+	if got := failureReason(fmt.Errorf("retry: %w", ocrErr)); got != "ocr" {
+		t.Errorf("wrapped failureReason = %q, want ocr", got)
+	}
+	if got := failureReason(errors.New("plain")); got != "unknown" {
+		t.Errorf("failureReason(plain) = %q, want unknown", got)
+	}
+}
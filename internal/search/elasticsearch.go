@@ -6,34 +6,109 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
+	"log/slog"
+	"mangasearch/internal/db"
+	"mangasearch/internal/layout"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/textblock"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const indexName = "manga_pages"
-const mapping = `{
-  "mappings": {
-    "properties": {
-      "series":  { "type": "keyword" },
-      "chapter": { "type": "keyword" },
-      "page":    { "type": "keyword" },
-      "path":    { "type": "keyword" },
-      "text":    { "type": "text" }
+
+// Each speech bubble is a nested block so phrase queries match inside one
+// bubble instead of across two. The cjk sub-field bigrams Japanese, Chinese
+// and Korean text, which the standard analyzer would otherwise index one
+// character at a time.
+const properties = `{
+  "properties": {
+    "id":       { "type": "long" },
+    "library":  { "type": "keyword" },
+    "series":   { "type": "keyword" },
+    "chapter":  { "type": "keyword" },
+    "page":     { "type": "keyword" },
+    "path":     { "type": "keyword" },
+    "language": { "type": "keyword" },
+    "languages": { "type": "keyword" },
+    "corrected": { "type": "boolean" },
+    "text": {
+      "type": "text",
+      "fields": {
+        "cjk": { "type": "text", "analyzer": "cjk" }
+      }
+    },
+    "blocks": {
+      "type": "nested",
+      "properties": {
+        "index": { "type": "integer" },
+        "text": {
+          "type": "text",
+          "fields": {
+            "cjk": { "type": "text", "analyzer": "cjk" }
+          }
+        }
+      }
     }
   }
 }`
 
+const mapping = `{"mappings": ` + properties + `}`
+
 type Client struct {
-	es *elasticsearch.Client
+	es  *elasticsearch.Client
+	log *slog.Logger
+}
+
+// Options says how to reach the cluster. Set Addresses or CloudID, not
+// both. APIKey wins over Username and Password. CACertFile and
+// Fingerprint are only needed for certificates the system doesn't trust.
+type Options struct {
+	Addresses   []string
+	CloudID     string
+	Username    string
+	Password    string
+	APIKey      string
+	CACertFile  string
+	Fingerprint string
 }
 
-func New(address string) (*Client, error) {
+func New(opts Options, logger *slog.Logger) (*Client, error) {
 	cfg := elasticsearch.Config{
-		Addresses: []string{address},
+		Addresses:              opts.Addresses,
+		CloudID:                opts.CloudID,
+		Username:               opts.Username,
+		Password:               opts.Password,
+		APIKey:                 opts.APIKey,
+		CertificateFingerprint: opts.Fingerprint,
+	}
+	if opts.CACertFile != "" {
+		cert, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("elasticsearch.New ca cert: %w", err)
+		}
+		cfg.CACert = cert
 	}
 	es, err := elasticsearch.NewClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("elasticsearch.New: %w", err)
 	}
-	return &Client{es: es}, nil
+	return &Client{es: es, log: logging.OrDefault(logger).With("component", "search")}, nil
+}
+
+// Health fails unless the cluster answers _cluster/health.
+func (c *Client) Health(ctx context.Context) error {
+	res, err := c.es.Cluster.Health(c.es.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	return nil
 }
 
 func (c *Client) InitIndex(ctx context.Context) error {
@@ -43,7 +118,10 @@ func (c *Client) InitIndex(ctx context.Context) error {
 	}
 	defer res.Body.Close()
 	if res.StatusCode == 200 {
-		return nil
+		if err := c.updateMapping(ctx); err != nil {
+			return err
+		}
+		return c.deleteUnkeyed(ctx)
 	}
 
 	res, err = c.es.Indices.Create(
@@ -58,6 +136,25 @@ func (c *Client) InitIndex(ctx context.Context) error {
 	if res.IsError() {
 		return fmt.Errorf("InitIndex create response: %s", res.String())
 	}
+	c.log.InfoContext(ctx, "created index", "index", indexName)
+	return nil
+}
+
+// updateMapping adds any fields introduced since the index was created.
+// Existing documents pick them up the next time they are indexed.
+func (c *Client) updateMapping(ctx context.Context) error {
+	res, err := c.es.Indices.PutMapping(
+		[]string{indexName},
+		bytes.NewReader([]byte(properties)),
+		c.es.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("InitIndex put mapping: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("InitIndex put mapping response: %s", res.String())
+	}
 	return nil
 }
 
@@ -73,14 +170,117 @@ func (c *Client) DeleteIndex(ctx context.Context) error {
 	return nil
 }
 
-func (c *Client) IndexPage(ctx context.Context, series, chapter, page, path, text string) error {
-	doc := map[string]string{
-		"series":  series,
-		"chapter": chapter,
-		"page":    page,
-		"path":    path,
-		"text":    text,
+// DeletePaths removes the documents of the given pages.
+func (c *Client) DeletePaths(ctx context.Context, paths []string) error {
+	const chunk = 1000
+	for start := 0; start < len(paths); start += chunk {
+		end := min(start+chunk, len(paths))
+		body, err := json.Marshal(map[string]interface{}{
+			"query": map[string]interface{}{
+				"terms": map[string]interface{}{"path": paths[start:end]},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("DeletePaths marshal: %w", err)
+		}
+		res, err := c.es.DeleteByQuery(
+			[]string{indexName},
+			bytes.NewReader(body),
+			c.es.DeleteByQuery.WithContext(ctx),
+			c.es.DeleteByQuery.WithConflicts("proceed"),
+		)
+		if err != nil {
+			return fmt.Errorf("DeletePaths: %w", err)
+		}
+		res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("DeletePaths response: %s", res.String())
+		}
 	}
+	c.log.InfoContext(ctx, "deleted pages", "pages", len(paths))
+	return nil
+}
+
+// DeletePages removes the documents of one library, series, chapter or
+// path prefix. Empty arguments match everything.
+func (c *Client) DeletePages(ctx context.Context, library, series, chapter, prefix string) error {
+	filter := []interface{}{}
+	if library != "" {
+		filter = append(filter, libraryTerm(library))
+	}
+	for field, value := range map[string]string{"series": series, "chapter": chapter} {
+		if value != "" {
+			filter = append(filter, map[string]interface{}{
+				"term": map[string]interface{}{field: value},
+			})
+		}
+	}
+	if prefix != "" {
+		filter = append(filter, map[string]interface{}{
+			"prefix": map[string]interface{}{"path": prefix},
+		})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filter},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DeletePages marshal: %w", err)
+	}
+
+	res, err := c.es.DeleteByQuery(
+		[]string{indexName},
+		bytes.NewReader(body),
+		c.es.DeleteByQuery.WithContext(ctx),
+		c.es.DeleteByQuery.WithConflicts("proceed"),
+		c.es.DeleteByQuery.WithRefresh(true),
+	)
+	if err != nil {
+		return fmt.Errorf("DeletePages: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("DeletePages response: %s", res.String())
+	}
+	c.log.InfoContext(ctx, "deleted pages", "series", series, "chapter", chapter, "prefix", prefix)
+	return nil
+}
+
+type Document struct {
+	ID        int64             `json:"id"`
+	Library   string            `json:"library"`
+	Series    string            `json:"series"`
+	Chapter   string            `json:"chapter"`
+	Page      string            `json:"page"`
+	Path      string            `json:"path"`
+	Text      string            `json:"text"`
+	Language  string            `json:"language"`
+	Languages []string          `json:"languages"`
+	Corrected bool              `json:"corrected"`
+	Blocks    []textblock.Block `json:"blocks"`
+}
+
+// DocumentFor builds the document of a saved page. A human correction, if
+// any, replaces the OCR text.
+func DocumentFor(p db.Page) Document {
+	return Document{
+		ID:        p.ID,
+		Library:   p.Library,
+		Series:    p.Series,
+		Chapter:   p.Chapter,
+		Page:      p.Page,
+		Path:      p.Path,
+		Text:      p.EffectiveText(),
+		Language:  p.Language,
+		Languages: strings.Split(p.Language, "+"),
+		Corrected: p.Corrected,
+		Blocks:    p.EffectiveBlocks(),
+	}
+}
+
+func (c *Client) IndexPage(ctx context.Context, doc Document) error {
+	began := time.Now()
 	body, err := json.Marshal(doc)
 	if err != nil {
 		return fmt.Errorf("IndexPage marshal: %w", err)
@@ -89,6 +289,7 @@ func (c *Client) IndexPage(ctx context.Context, series, chapter, page, path, tex
 	res, err := c.es.Index(
 		indexName,
 		bytes.NewReader(body),
+		c.es.Index.WithDocumentID(strconv.FormatInt(doc.ID, 10)),
 		c.es.Index.WithContext(ctx),
 	)
 	if err != nil {
@@ -98,24 +299,186 @@ func (c *Client) IndexPage(ctx context.Context, series, chapter, page, path, tex
 	if res.IsError() {
 		return fmt.Errorf("IndexPage response: %s", res.String())
 	}
+	c.log.DebugContext(ctx, "indexed document", "id", doc.ID, "took", time.Since(began))
+	return nil
+}
+
+// deleteUnkeyed removes documents indexed before pages had ids. They were
+// stored under random ids, so reindexing a page by id would leave them
+// behind as duplicates.
+func (c *Client) deleteUnkeyed(ctx context.Context) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{
+					"exists": map[string]interface{}{"field": "id"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("InitIndex unkeyed marshal: %w", err)
+	}
+
+	res, err := c.es.DeleteByQuery(
+		[]string{indexName},
+		bytes.NewReader(body),
+		c.es.DeleteByQuery.WithContext(ctx),
+		c.es.DeleteByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return fmt.Errorf("InitIndex unkeyed delete: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("InitIndex unkeyed delete response: %s", res.String())
+	}
+	var out struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err == nil && out.Deleted > 0 {
+		c.log.InfoContext(ctx, "deleted documents without a page id", "count", out.Deleted)
+	}
 	return nil
 }
 
 type SearchResult struct {
-	Series  string `json:"series"`
-	Chapter string `json:"chapter"`
-	Page    string `json:"page"`
-	Path    string `json:"path"`
-	Text    string `json:"text"`
+	ID        int64  `json:"id"`
+	Library   string `json:"library,omitempty"`
+	Series    string `json:"series"`
+	Chapter   string `json:"chapter"`
+	Page      string `json:"page"`
+	Path      string `json:"path"`
+	Text      string `json:"text"`
+	Language  string `json:"language"`
+	Corrected bool   `json:"corrected"`
+	Block     string `json:"block,omitempty"`
+	Highlight string `json:"highlight,omitempty"`
 }
 
-func (c *Client) Search(ctx context.Context, query string) ([]SearchResult, error) {
+// Filters narrow a search to exact keyword matches. Empty fields are ignored.
+type Filters struct {
+	Library  string
+	Series   string
+	Chapter  string
+	Language string
+}
+
+func (f Filters) terms() []interface{} {
+	var terms []interface{}
+	if f.Library != "" {
+		terms = append(terms, libraryTerm(f.Library))
+	}
+	for field, value := range map[string]string{
+		"series":  f.Series,
+		"chapter": f.Chapter,
+	} {
+		if value != "" {
+			terms = append(terms, map[string]interface{}{
+				"term": map[string]interface{}{field: value},
+			})
+		}
+	}
+	// A page OCR'd as "ja+en" matches both ja and en. Documents indexed
+	// before languages existed only carry the combined key.
+	if f.Language != "" {
+		terms = append(terms, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"minimum_should_match": 1,
+				"should": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"languages": f.Language}},
+					map[string]interface{}{"term": map[string]interface{}{"language": f.Language}},
+				},
+			},
+		})
+	}
+	return terms
+}
+
+// libraryTerm matches the pages of one library. Documents indexed before
+// libraries existed have none and belong to the default library.
+func libraryTerm(library string) interface{} {
+	term := map[string]interface{}{"term": map[string]interface{}{"library": library}}
+	if library != layout.DefaultLibrary {
+		return term
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"minimum_should_match": 1,
+			"should": []interface{}{
+				term,
+				map[string]interface{}{"bool": map[string]interface{}{
+					"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "library"}},
+				}},
+			},
+		},
+	}
+}
+
+// highlight wraps matches in <mark>. The html encoder escapes the rest of
+// the OCR text, so the snippet is safe to render as HTML.
+var highlight = map[string]interface{}{
+	"encoder":   "html",
+	"pre_tags":  []string{"<mark>"},
+	"post_tags": []string{"</mark>"},
+}
+
+func highlightFields(fields ...string) map[string]interface{} {
+	h := make(map[string]interface{}, len(highlight)+1)
+	for k, v := range highlight {
+		h[k] = v
+	}
+	f := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		f[field] = map[string]interface{}{"number_of_fragments": 1, "fragment_size": 160}
+	}
+	h["fields"] = f
+	return h
+}
+
+func (c *Client) Search(ctx context.Context, query string, filters Filters) ([]SearchResult, error) {
+	began := time.Now()
+	boolQuery := map[string]interface{}{
+		"minimum_should_match": 1,
+		"should": []interface{}{
+			map[string]interface{}{
+				"nested": map[string]interface{}{
+					"path":            "blocks",
+					"ignore_unmapped": true,
+					"query": map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":  query,
+							"type":   "phrase",
+							"fields": []string{"blocks.text", "blocks.text.cjk"},
+							"boost":  2,
+						},
+					},
+					"inner_hits": map[string]interface{}{
+						"size":      1,
+						"highlight": highlightFields("blocks.text", "blocks.text.cjk"),
+					},
+				},
+			},
+			map[string]interface{}{
+				"multi_match": map[string]interface{}{
+					"query":  query,
+					"fields": []string{"text", "text.cjk"},
+				},
+			},
+		},
+	}
+	if terms := filters.terms(); len(terms) > 0 {
+		boolQuery["filter"] = terms
+	}
+
 	body, err := json.Marshal(map[string]interface{}{
+		"_source": map[string]interface{}{
+			"excludes": []string{"blocks"},
+		},
 		"query": map[string]interface{}{
-			"match": map[string]interface{}{
-				"text": query,
-			},
+			"bool": boolQuery,
 		},
+		"highlight": highlightFields("text", "text.cjk"),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("Search marshal: %w", err)
@@ -137,7 +500,18 @@ func (c *Client) Search(ctx context.Context, query string) ([]SearchResult, erro
 	var response struct {
 		Hits struct {
 			Hits []struct {
-				Source SearchResult `json:"_source"`
+				Source    SearchResult        `json:"_source"`
+				Highlight map[string][]string `json:"highlight"`
+				InnerHits struct {
+					Blocks struct {
+						Hits struct {
+							Hits []struct {
+								Source    textblock.Block     `json:"_source"`
+								Highlight map[string][]string `json:"highlight"`
+							} `json:"hits"`
+						} `json:"hits"`
+					} `json:"blocks"`
+				} `json:"inner_hits"`
 			} `json:"hits"`
 		} `json:"hits"`
 	}
@@ -147,7 +521,25 @@ func (c *Client) Search(ctx context.Context, query string) ([]SearchResult, erro
 
 	results := make([]SearchResult, 0, len(response.Hits.Hits))
 	for _, hit := range response.Hits.Hits {
-		results = append(results, hit.Source)
+		result := hit.Source
+		result.Highlight = firstFragment(hit.Highlight, "text", "text.cjk")
+		if blocks := hit.InnerHits.Blocks.Hits.Hits; len(blocks) > 0 {
+			result.Block = blocks[0].Source.Text
+			if h := firstFragment(blocks[0].Highlight, "blocks.text", "blocks.text.cjk"); h != "" {
+				result.Highlight = h
+			}
+		}
+		results = append(results, result)
 	}
+	c.log.DebugContext(ctx, "searched", "query", query, "hits", len(results), "took", time.Since(began))
 	return results, nil
 }
+
+func firstFragment(highlights map[string][]string, fields ...string) string {
+	for _, field := range fields {
+		if fragments := highlights[field]; len(fragments) > 0 {
+			return fragments[0]
+		}
+	}
+	return ""
+}
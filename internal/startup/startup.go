@@ -2,78 +2,93 @@ package startup
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 	"mangasearch/internal/config"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/queue"
+	"mangasearch/internal/search"
+
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
-func Boot(ctx context.Context, cfg *config.Config) error {
-	if err := startDocker(); err != nil {
-		return fmt.Errorf("docker compose: %w", err)
+// Boot waits until every service answers. With cfg.ManageDocker it first
+// brings them up with docker compose; otherwise they are expected to be
+// running already, possibly on other hosts. Readiness is checked with
+// each service's own client either way, so addresses, TLS and credentials
+// come from the config. es is checked with the client the app will use.
+func Boot(ctx context.Context, cfg *config.Config, es *search.Client, logger *slog.Logger) error {
+	log := logging.OrDefault(logger).With("component", "startup")
+	if cfg.ManageDocker {
+		if err := startDocker(log); err != nil {
+			return fmt.Errorf("docker compose: %w", err)
+		}
 	}
-	if err := waitForPostgres(ctx, cfg); err != nil {
+	if err := waitForPostgres(ctx, cfg, log); err != nil {
 		return fmt.Errorf("postgres not ready: %w", err)
 	}
-	if err := waitForRedis(ctx, cfg); err != nil {
+	if err := waitForRedis(ctx, cfg, log); err != nil {
 		return fmt.Errorf("redis not ready: %w", err)
 	}
-	if err := waitForElasticsearch(ctx, cfg); err != nil {
+	if err := waitForElasticsearch(ctx, es, log); err != nil {
 		return fmt.Errorf("elasticsearch not ready: %w", err)
 	}
-	if err := waitForOCRServer(ctx, cfg); err != nil {
+	if err := waitForOCRServer(ctx, cfg, log); err != nil {
 		return fmt.Errorf("ocr server not ready: %w", err)
 	}
 	return nil
 }
 
-func startDocker() error {
-	fmt.Println("starting docker compose...")
+func startDocker(log *slog.Logger) error {
+	log.Info("starting docker compose")
 	cmd := exec.Command("docker", "compose", "up", "-d")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func waitForPostgres(ctx context.Context, cfg *config.Config) error {
-	fmt.Println("waiting for postgres...")
+func waitForPostgres(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
+	log.Info("waiting for postgres")
+	conn, err := sql.Open("postgres", cfg.PostgresDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 	return retry(ctx, 30, 2*time.Second, func() error {
-		cmd := exec.Command("docker", "exec", "mangasearch-postgres-1",
-			"pg_isready", "-U", "manga", "-d", "mangasearch")
-		return cmd.Run()
+		return conn.PingContext(ctx)
 	})
 }
 
-func waitForRedis(ctx context.Context, cfg *config.Config) error {
-	fmt.Println("waiting for redis...")
+func waitForRedis(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
+	log.Info("waiting for redis")
+	opts, err := queue.RedisOptions(cfg.RedisURL, cfg.RedisPassword)
+	if err != nil {
+		return err
+	}
+	client := redis.NewClient(opts)
+	defer client.Close()
 	return retry(ctx, 30, 2*time.Second, func() error {
-		cmd := exec.Command("docker", "exec", "mangasearch-redis-1",
-			"redis-cli", "ping")
-		return cmd.Run()
+		return client.Ping(ctx).Err()
 	})
 }
 
-func waitForElasticsearch(ctx context.Context, cfg *config.Config) error {
-	fmt.Println("waiting for elasticsearch...")
-	url := fmt.Sprintf("http://localhost:%d/_cluster/health", cfg.ESPort)
+func waitForElasticsearch(ctx context.Context, es *search.Client, log *slog.Logger) error {
+	log.Info("waiting for elasticsearch")
 	return retry(ctx, 60, 3*time.Second, func() error {
-		resp, err := http.Get(url)
-		if err != nil {
-			return err
-		}
-		resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("status %d", resp.StatusCode)
-		}
-		return nil
+		return es.Health(ctx)
 	})
 }
 
-func waitForOCRServer(ctx context.Context, cfg *config.Config) error {
-	fmt.Println("waiting for ocr server...")
-	url := fmt.Sprintf("http://localhost:%d/health", cfg.OCRPort)
+func waitForOCRServer(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
+	log.Info("waiting for ocr server")
+	url := strings.TrimRight(cfg.OCRURL, "/") + "/health"
 	if err := retry(ctx, 60, 3*time.Second, func() error {
 		resp, err := http.Get(url)
 		if err != nil {
@@ -84,14 +99,15 @@ func waitForOCRServer(ctx context.Context, cfg *config.Config) error {
 	}); err != nil {
 		return err
 	}
-	fmt.Println("ocr server up — waiting for workers to stabilize...")
+	log.Info("ocr server up, waiting for workers to stabilize")
 	time.Sleep(time.Duration(cfg.Workers) * 3 * time.Second)
 	return nil
 }
 
 func retry(ctx context.Context, attempts int, delay time.Duration, fn func() error) error {
+	var err error
 	for i := 0; i < attempts; i++ {
-		if err := fn(); err == nil {
+		if err = fn(); err == nil {
 			return nil
 		}
 		select {
@@ -100,5 +116,5 @@ func retry(ctx context.Context, attempts int, delay time.Duration, fn func() err
 		case <-time.After(delay):
 		}
 	}
-	return fmt.Errorf("timed out after %d attempts", attempts)
+	return fmt.Errorf("timed out after %d attempts: %w", attempts, err)
 }
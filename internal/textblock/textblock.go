@@ -0,0 +1,156 @@
+package textblock
+
+import (
+	"sort"
+	"strings"
+
+	"mangasearch/internal/ocr"
+)
+
+type Block struct {
+	Index int     `json:"index"`
+	Text  string  `json:"text"`
+	X0    float64 `json:"x0"`
+	Y0    float64 `json:"y0"`
+	X1    float64 `json:"x1"`
+	Y1    float64 `json:"y1"`
+}
+
+type Options struct {
+	// RightToLeft orders blocks in a row right to left, as manga is read.
+	RightToLeft bool
+	// Vertical orders fragments inside a block as columns instead of lines.
+	Vertical bool
+	// Proximity is how far apart two fragments can be, in multiples of
+	// their character size, and still belong to the same block.
+	Proximity float64
+}
+
+// Group clusters OCR fragments into text blocks by spatial proximity and
+// returns them in reading order.
+func Group(fragments []ocr.Fragment, opts Options) []Block {
+	if opts.Proximity <= 0 {
+		opts.Proximity = 1
+	}
+
+	parent := make([]int, len(fragments))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range fragments {
+		for j := i + 1; j < len(fragments); j++ {
+			if near(fragments[i], fragments[j], opts.Proximity) {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	clusters := make(map[int][]ocr.Fragment)
+	var roots []int
+	for i, f := range fragments {
+		root := find(i)
+		if _, ok := clusters[root]; !ok {
+			roots = append(roots, root)
+		}
+		clusters[root] = append(clusters[root], f)
+	}
+
+	blocks := make([]Block, 0, len(roots))
+	for _, root := range roots {
+		members := clusters[root]
+		orderFragments(members, opts.Vertical)
+		b := Block{X0: members[0].X0, Y0: members[0].Y0, X1: members[0].X1, Y1: members[0].Y1}
+		texts := make([]string, 0, len(members))
+		for _, f := range members {
+			b.X0, b.Y0 = min(b.X0, f.X0), min(b.Y0, f.Y0)
+			b.X1, b.Y1 = max(b.X1, f.X1), max(b.Y1, f.Y1)
+			texts = append(texts, f.Text)
+		}
+		b.Text = strings.Join(texts, " ")
+		blocks = append(blocks, b)
+	}
+
+	orderBlocks(blocks, opts.RightToLeft)
+	for i := range blocks {
+		blocks[i].Index = i
+	}
+	return blocks
+}
+
+// Join renders blocks as page text, one block per line.
+func Join(blocks []Block) string {
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		texts = append(texts, b.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func charSize(f ocr.Fragment) float64 {
+	return min(f.X1-f.X0, f.Y1-f.Y0)
+}
+
+func near(a, b ocr.Fragment, proximity float64) bool {
+	gap := proximity * max(charSize(a), charSize(b))
+	return a.X0-gap <= b.X1 && b.X0 <= a.X1+gap &&
+		a.Y0-gap <= b.Y1 && b.Y0 <= a.Y1+gap
+}
+
+// orderFragments sorts a block's fragments into lines top to bottom, left to
+// right, or for vertical text into columns right to left, top to bottom.
+func orderFragments(fs []ocr.Fragment, vertical bool) {
+	if vertical {
+		sort.SliceStable(fs, func(i, j int) bool { return fs[i].X1 > fs[j].X1 })
+		for start := 0; start < len(fs); {
+			end, colLeft := start+1, fs[start].X0
+			for end < len(fs) && fs[end].X1 > colLeft {
+				colLeft = min(colLeft, fs[end].X0)
+				end++
+			}
+			col := fs[start:end]
+			sort.SliceStable(col, func(i, j int) bool { return col[i].Y0 < col[j].Y0 })
+			start = end
+		}
+		return
+	}
+	sort.SliceStable(fs, func(i, j int) bool { return fs[i].Y0 < fs[j].Y0 })
+	for start := 0; start < len(fs); {
+		end, lineBottom := start+1, fs[start].Y1
+		for end < len(fs) && fs[end].Y0 < lineBottom {
+			lineBottom = max(lineBottom, fs[end].Y1)
+			end++
+		}
+		line := fs[start:end]
+		sort.SliceStable(line, func(i, j int) bool { return line[i].X0 < line[j].X0 })
+		start = end
+	}
+}
+
+// orderBlocks groups blocks into rows that overlap vertically, reads rows
+// top to bottom and blocks within a row in the configured direction.
+func orderBlocks(blocks []Block, rightToLeft bool) {
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Y0 < blocks[j].Y0 })
+	for start := 0; start < len(blocks); {
+		end, rowBottom := start+1, blocks[start].Y1
+		for end < len(blocks) && blocks[end].Y0 < rowBottom {
+			rowBottom = max(rowBottom, blocks[end].Y1)
+			end++
+		}
+		row := blocks[start:end]
+		sort.SliceStable(row, func(i, j int) bool {
+			if rightToLeft {
+				return row[i].X1 > row[j].X1
+			}
+			return row[i].X0 < row[j].X0
+		})
+		start = end
+	}
+}
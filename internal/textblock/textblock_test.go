@@ -0,0 +1,93 @@
+package textblock
+
+import (
+	"testing"
+
+	"mangasearch/internal/ocr"
+)
+
+func frag(text string, x0, y0, x1, y1 float64) ocr.Fragment {
+	return ocr.Fragment{Text: text, X0: x0, Y0: y0, X1: x1, Y1: y1}
+}
+
+func TestGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		fragments []ocr.Fragment
+		opts      Options
+		want      []string
+	}{
+		{
+			name:      "empty page",
+			fragments: nil,
+			want:      []string{},
+		},
+		{
+			name: "two bubbles are not interleaved",
+			fragments: []ocr.Fragment{
+				// detection order jumps between the two bubbles
+				frag("I", 400, 100, 420, 120),
+				frag("WHO", 50, 110, 110, 130),
+				frag("SACRIFICE", 400, 125, 520, 145),
+				frag("ARE YOU?", 50, 135, 150, 155),
+			},
+			opts: Options{RightToLeft: true},
+			want: []string{"I SACRIFICE", "WHO ARE YOU?"},
+		},
+		{
+			name: "left to right reading order",
+			fragments: []ocr.Fragment{
+				frag("RIGHT", 400, 100, 460, 120),
+				frag("LEFT", 50, 100, 100, 120),
+			},
+			opts: Options{RightToLeft: false},
+			want: []string{"LEFT", "RIGHT"},
+		},
+		{
+			name: "rows read top to bottom before right to left",
+			fragments: []ocr.Fragment{
+				frag("BOTTOM RIGHT", 400, 500, 520, 520),
+				frag("TOP LEFT", 50, 100, 140, 120),
+				frag("BOTTOM LEFT", 50, 500, 160, 520),
+			},
+			opts: Options{RightToLeft: true},
+			want: []string{"TOP LEFT", "BOTTOM RIGHT", "BOTTOM LEFT"},
+		},
+		{
+			name: "lines inside a bubble read left to right",
+			fragments: []ocr.Fragment{
+				frag("WORLD", 160, 100, 220, 120),
+				frag("HELLO", 100, 100, 155, 120),
+				frag("AGAIN", 100, 125, 160, 145),
+			},
+			opts: Options{RightToLeft: true},
+			want: []string{"HELLO WORLD AGAIN"},
+		},
+		{
+			name: "vertical columns read right to left",
+			fragments: []ocr.Fragment{
+				frag("左", 100, 100, 120, 200),
+				frag("右", 125, 100, 145, 200),
+			},
+			opts: Options{RightToLeft: true, Vertical: true},
+			want: []string{"右 左"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := Group(tt.fragments, tt.opts)
+			if len(blocks) != len(tt.want) {
+				t.Fatalf("got %d blocks %+v, want %v", len(blocks), blocks, tt.want)
+			}
+			for i, b := range blocks {
+				if b.Text != tt.want[i] {
+					t.Errorf("block %d: got %q, want %q", i, b.Text, tt.want[i])
+				}
+				if b.Index != i {
+					t.Errorf("block %d: index %d", i, b.Index)
+				}
+			}
+		})
+	}
+}
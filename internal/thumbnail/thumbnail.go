@@ -0,0 +1,120 @@
+package thumbnail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"mangasearch/internal/imageformat"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	DefaultWidth = 300
+	jpegQuality  = 80
+)
+
+// Widths are the only sizes generated, so each page has at most one cached
+// thumbnail per entry no matter what clients ask for.
+var Widths = []int{150, 300, 600, 1200}
+
+// Cache stores resized JPEG thumbnails on disk, keyed by source path, its
+// modification time and the requested width, so a changed page gets a new
+// thumbnail instead of a stale one.
+type Cache struct {
+	dir       string
+	converter []string
+}
+
+// NewCache stores thumbnails under dir. converter is as for
+// imageformat.Decode.
+func NewCache(dir string, converter []string) *Cache {
+	return &Cache{dir: dir, converter: converter}
+}
+
+// Key identifies one thumbnail. It doubles as the HTTP ETag.
+func Key(path string, modTime time.Time, width int) string {
+	sum := sha256.Sum256([]byte(path + "|" + strconv.FormatInt(modTime.UnixNano(), 10) + "|" + strconv.Itoa(width)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Get returns the path of a cached thumbnail, generating it from open if it
+// does not exist yet.
+func (c *Cache) Get(key string, width int, open func() (io.ReadCloser, error)) (string, error) {
+	target := filepath.Join(c.dir, key[:2], key+".jpg")
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+
+	src, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	raw, err := io.ReadAll(src)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail read: %w", err)
+	}
+	img, err := imageformat.Decode(raw, c.converter)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail decode: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("thumbnail mkdir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), key+"-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("thumbnail create: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := jpeg.Encode(tmp, Resize(img, width), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("thumbnail encode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("thumbnail close: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("thumbnail rename: %w", err)
+	}
+	return target, nil
+}
+
+// Resize scales img to width, keeping its aspect ratio. Images already
+// narrower than width are returned as they are.
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// SnapWidth parses a requested width and rounds it up to the nearest of
+// Widths, falling back to DefaultWidth.
+func SnapWidth(raw string) int {
+	w, err := strconv.Atoi(raw)
+	if err != nil || w <= 0 {
+		return DefaultWidth
+	}
+	for _, size := range Widths {
+		if w <= size {
+			return size
+		}
+	}
+	return Widths[len(Widths)-1]
+}
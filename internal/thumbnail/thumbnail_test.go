@@ -0,0 +1,96 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSnapWidth(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{"", DefaultWidth},
+		{"abc", DefaultWidth},
+		{"-5", DefaultWidth},
+		{"1", 150},
+		{"150", 150},
+		{"151", 300},
+		{"500", 600},
+		{"5000", 1200},
+	}
+	for _, tt := range tests {
+		if got := SnapWidth(tt.raw); got != tt.want {
+			t.Errorf("SnapWidth(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 400, 600))
+	if b := Resize(img, 200).Bounds(); b.Dx() != 200 || b.Dy() != 300 {
+		t.Errorf("Resize to 200 = %v, want 200x300", b)
+	}
+	if got := Resize(img, 800); got != image.Image(img) {
+		t.Error("Resize should leave narrower images alone")
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 400, 600))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	src.Set(10, 10, color.Black)
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCache(t.TempDir(), nil)
+	key := Key("/manga/Berserk/ch1/001.png", time.Unix(1700000000, 0), 150)
+	opens := 0
+	open := func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(bytes.NewReader(encoded.Bytes())), nil
+	}
+
+	path, err := cache.Get(key, 150, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := jpeg.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 150 || b.Dy() != 225 {
+		t.Errorf("thumbnail is %v, want 150x225", b)
+	}
+
+	again, err := cache.Get(key, 150, func() (io.ReadCloser, error) {
+		return nil, errors.New("source should not be reopened")
+	})
+	if err != nil || again != path {
+		t.Errorf("second Get = %q, %v; want cached %q", again, err, path)
+	}
+	if opens != 1 {
+		t.Errorf("source opened %d times, want 1", opens)
+	}
+
+	if other := Key("/manga/Berserk/ch1/001.png", time.Unix(1700000001, 0), 150); other == key {
+		t.Error("a changed modification time must change the key")
+	}
+}
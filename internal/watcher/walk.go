@@ -0,0 +1,283 @@
+package watcher
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"mangasearch/internal/container"
+	"mangasearch/internal/ignore"
+)
+
+// DefaultParallelism is how many folders a scan reads at once when
+// Options.Parallelism isn't set.
+const DefaultParallelism = 4
+
+// maxReportErrors caps the errors a report keeps; ErrorCount still counts
+// them all.
+const maxReportErrors = 100
+
+// Report describes the last scan of a root.
+type Report struct {
+	Root            string      `json:"root"`
+	StartedAt       time.Time   `json:"started_at"`
+	DurationSeconds float64     `json:"duration_seconds"`
+	Dirs            int         `json:"dirs"`
+	Files           int         `json:"files"`
+	Pages           int         `json:"pages"`
+	SymlinksSkipped int         `json:"symlinks_skipped"`
+	ErrorCount      int         `json:"error_count"`
+	Errors          []ScanError `json:"errors"`
+	// Error is set when the scan failed outright, as when the root can't
+	// be read.
+	Error string `json:"error,omitempty"`
+}
+
+// ScanError is a folder, file or archive a scan couldn't read.
+type ScanError struct {
+	Path  string `json:"path"`
+	Op    string `json:"op"`
+	Error string `json:"error"`
+}
+
+type dirTask struct {
+	path  string
+	rules ignore.Rules
+	// ancestors are the real paths of the folders above and including
+	// this one, to catch symlinks that loop back.
+	ancestors []string
+}
+
+// dirQueue hands folders to the scan workers. It grows as folders are
+// found, so workers never block each other, and pop reports false once
+// every pushed folder is done.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []dirTask
+	pending int
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(t dirTask) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, t)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *dirQueue) pop() (dirTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		return dirTask{}, false
+	}
+	// Depth first keeps the queue short on deep trees.
+	t := q.tasks[len(q.tasks)-1]
+	q.tasks = q.tasks[:len(q.tasks)-1]
+	return t, true
+}
+
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	finished := q.pending == 0
+	q.mu.Unlock()
+	if finished {
+		q.cond.Broadcast()
+	}
+}
+
+// walk is one scan in progress.
+type walk struct {
+	w          *Watcher
+	queue      *dirQueue
+	mu         sync.Mutex
+	found      map[string]time.Time
+	unreadable []string
+	report     Report
+	rootErr    error
+}
+
+// walkRoot reads every folder under the root with w.parallelism workers.
+func (w *Watcher) walkRoot() *walk {
+	wk := &walk{
+		w:      w,
+		queue:  newDirQueue(),
+		found:  make(map[string]time.Time),
+		report: Report{Root: w.mainFolder, StartedAt: time.Now(), Errors: []ScanError{}},
+	}
+	root := filepath.Clean(w.mainFolder)
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		real = root
+	}
+	wk.queue.push(dirTask{path: root, rules: w.ignore, ancestors: []string{real}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				t, ok := wk.queue.pop()
+				if !ok {
+					return
+				}
+				wk.readDir(t)
+				wk.queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+	wk.report.Pages = len(wk.found)
+	wk.report.DurationSeconds = time.Since(wk.report.StartedAt).Seconds()
+	return wk
+}
+
+func (wk *walk) readDir(t dirTask) {
+	entries, err := os.ReadDir(t.path)
+	if err != nil {
+		wk.w.log.Warn("cannot read folder", "path", t.path, "error", err)
+		wk.fail(t.path, "readdir", err)
+		if t.path == filepath.Clean(wk.w.mainFolder) {
+			wk.mu.Lock()
+			wk.rootErr = err
+			wk.mu.Unlock()
+		}
+		return
+	}
+	wk.mu.Lock()
+	wk.report.Dirs++
+	wk.mu.Unlock()
+
+	rules, err := t.rules.Load(t.path)
+	if err != nil {
+		wk.w.log.Warn("cannot read ignore file", "path", t.path, "error", err)
+		wk.addError(filepath.Join(t.path, ignore.FileName), "ignore", err)
+	}
+	for _, entry := range entries {
+		fullPath := filepath.Join(t.path, entry.Name())
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				wk.addError(fullPath, "symlink", err)
+				continue
+			}
+			isDir = info.IsDir()
+			if isDir && !wk.w.followSymlinks {
+				wk.skipSymlink()
+				continue
+			}
+		}
+		if rules.Ignored(fullPath, isDir) {
+			continue
+		}
+		if isDir {
+			wk.enter(t, fullPath, entry, rules)
+			continue
+		}
+		wk.mu.Lock()
+		wk.report.Files++
+		wk.mu.Unlock()
+		if !wk.w.images.Match(entry.Name()) && !container.IsContainer(entry.Name()) {
+			continue
+		}
+		// Stat rather than entry.Info so a symlinked page has its target's
+		// time.
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			wk.fail(fullPath, "stat", err)
+			continue
+		}
+		if wk.w.images.Match(entry.Name()) {
+			wk.add(fullPath, info.ModTime())
+			continue
+		}
+		pages, err := container.List(fullPath, wk.w.images.Match)
+		if err != nil {
+			wk.w.log.Warn("cannot read archive", "path", fullPath, "error", err)
+			wk.fail(fullPath, "archive", err)
+			continue
+		}
+		for _, page := range pages {
+			pagePath := container.Join(fullPath, page)
+			if !rules.Ignored(pagePath, false) {
+				wk.add(pagePath, info.ModTime())
+			}
+		}
+	}
+}
+
+// enter queues a subfolder, unless it is a symlink back to a folder
+// the scan is already inside.
+func (wk *walk) enter(parent dirTask, path string, entry fs.DirEntry, rules ignore.Rules) {
+	real := filepath.Join(parent.ancestors[len(parent.ancestors)-1], entry.Name())
+	if entry.Type()&fs.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			wk.addError(path, "symlink", err)
+			return
+		}
+		for _, ancestor := range parent.ancestors {
+			if within(ancestor, target) {
+				wk.w.log.Warn("symlink loop", "path", path, "target", target)
+				wk.addError(path, "symlink", fmt.Errorf("loops back to %s", target))
+				wk.skipSymlink()
+				return
+			}
+		}
+		real = target
+	}
+	ancestors := append(parent.ancestors[:len(parent.ancestors):len(parent.ancestors)], real)
+	wk.queue.push(dirTask{path: path, rules: rules, ancestors: ancestors})
+}
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (wk *walk) add(path string, modTime time.Time) {
+	wk.mu.Lock()
+	wk.found[path] = modTime
+	wk.mu.Unlock()
+}
+
+func (wk *walk) skipSymlink() {
+	wk.mu.Lock()
+	wk.report.SymlinksSkipped++
+	wk.mu.Unlock()
+}
+
+// fail records a path the scan couldn't read. Its pages are kept rather
+// than deleted.
+func (wk *walk) fail(path, op string, err error) {
+	wk.mu.Lock()
+	wk.unreadable = append(wk.unreadable, path)
+	wk.mu.Unlock()
+	wk.addError(path, op, err)
+}
+
+func (wk *walk) addError(path, op string, err error) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	wk.report.ErrorCount++
+	if len(wk.report.Errors) < maxReportErrors {
+		wk.report.Errors = append(wk.report.Errors, ScanError{Path: path, Op: op, Error: err.Error()})
+	}
+}
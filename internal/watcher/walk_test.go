@@ -0,0 +1,91 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWalkReport(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Berserk/ch1/notes.txt": "",
+		"Berserk/ch2.cbz":       "not a zip",
+	}
+	for ch := 1; ch <= 20; ch++ {
+		for page := 1; page <= 3; page++ {
+			files[fmt.Sprintf("Vagabond/ch%02d/%03d.png", ch, page)] = ""
+		}
+	}
+	writeTree(t, root, files)
+
+	for _, parallelism := range []int{1, 3} {
+		w := NewWatcher(root, Options{Parallelism: parallelism}, nil)
+		if err := w.updateFiles(); err != nil {
+			t.Fatal(err)
+		}
+		r := w.Report()
+		// root, Berserk, Berserk/ch1, Vagabond and its 20 chapters
+		if r.Dirs != 24 || r.Files != 62 || r.Pages != 60 || len(w.Files()) != 60 {
+			t.Errorf("parallelism %d: dirs %d, files %d, pages %d; want 24, 62, 60", parallelism, r.Dirs, r.Files, r.Pages)
+		}
+		if r.ErrorCount != 1 || r.Errors[0].Op != "archive" || r.Errors[0].Path != filepath.Join(root, "Berserk", "ch2.cbz") {
+			t.Errorf("parallelism %d: errors = %+v, want the broken archive", parallelism, r.Errors)
+		}
+	}
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	root := t.TempDir()
+	elsewhere := t.TempDir()
+	writeTree(t, root, map[string]string{"Berserk/ch1/001.png": ""})
+	writeTree(t, elsewhere, map[string]string{"ch2/001.png": ""})
+	if err := os.Symlink(filepath.Join(elsewhere, "ch2"), filepath.Join(root, "Berserk", "ch2")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	// A link back up to the series folder would recurse forever.
+	if err := os.Symlink(filepath.Join(root, "Berserk"), filepath.Join(root, "Berserk", "ch1", "again")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		follow  bool
+		want    []string
+		skipped int
+		errors  int
+	}{
+		{false, []string{"Berserk/ch1/001.png"}, 2, 0},
+		{true, []string{"Berserk/ch1/001.png", "Berserk/ch2/001.png"}, 1, 1},
+	}
+	for _, tt := range tests {
+		w := NewWatcher(root, Options{FollowSymlinks: tt.follow}, nil)
+		if err := w.updateFiles(); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for path := range w.Files() {
+			rel, _ := filepath.Rel(root, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("follow %v: files = %v, want %v", tt.follow, got, tt.want)
+		}
+		if r := w.Report(); r.SymlinksSkipped != tt.skipped || r.ErrorCount != tt.errors {
+			t.Errorf("follow %v: %d symlinks skipped, %d errors; want %d and %d", tt.follow, r.SymlinksSkipped, r.ErrorCount, tt.skipped, tt.errors)
+		}
+	}
+}
+
+func TestUnreadableRootReport(t *testing.T) {
+	w := NewWatcher(filepath.Join(t.TempDir(), "unmounted"), Options{}, nil)
+	if err := w.updateFiles(); err == nil {
+		t.Fatal("want an error")
+	}
+	if r := w.Report(); r.Error == "" {
+		t.Errorf("report = %+v, want the failure recorded", r)
+	}
+}
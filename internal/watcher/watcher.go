@@ -2,11 +2,19 @@ package watcher
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"mangasearch/internal/container"
+	"mangasearch/internal/ignore"
+	"mangasearch/internal/imageformat"
+	"mangasearch/internal/logging"
+	"mangasearch/internal/metrics"
 )
 
 const defaultFolder = "/manga"
@@ -15,65 +23,167 @@ type SnapshotLoader interface {
 	LoadSnapshots(ctx context.Context) (map[string]time.Time, error)
 }
 
+// Options tune what a scan picks up.
+type Options struct {
+	// Ignore holds gitignore-style patterns relative to the root, applied
+	// on top of any ignore.FileName files found while scanning.
+	Ignore []string
+	// Formats are the image formats picked up, by imageformat name;
+	// imageformat.Default when empty.
+	Formats []string
+	// Parallelism is how many folders are read at once; DefaultParallelism
+	// when zero.
+	Parallelism int
+	// FollowSymlinks scans symlinked folders. Symlinks back into a folder
+	// the scan is already inside are skipped.
+	FollowSymlinks bool
+	// MaxDeleteRatio holds back a scan that would delete more than this
+	// share of the library's pages until ConfirmDeletions is called. Zero
+	// turns the check off.
+	MaxDeleteRatio float64
+}
+
+// TooManyDeletionsError is returned by Scan when a scan would delete more
+// pages than Options.MaxDeleteRatio allows, as when a mount drops and the
+// root looks empty. Nothing is queued or deleted.
+type TooManyDeletionsError struct {
+	Root      string
+	Deletions int
+	Pages     int
+	Ratio     float64
+}
+
+func (e *TooManyDeletionsError) Error() string {
+	return fmt.Sprintf("scan of %s would delete %d of %d pages, more than %.0f%%; confirm the deletions to go ahead",
+		e.Root, e.Deletions, e.Pages, e.Ratio*100)
+}
+
 type Watcher struct {
+	mu         sync.RWMutex
 	filesFound map[string]time.Time
-	mainFolder string
-	stopCh     chan struct{}
+	// unreadable are folders and containers the last scan couldn't read.
+	// Their pages are never deleted on its account.
+	unreadable     []string
+	known          int
+	held           int
+	confirmed      bool
+	maxDeleteRatio float64
+	parallelism    int
+	followSymlinks bool
+	images         imageformat.Set
+	report         Report
+	mainFolder     string
+	ignore         ignore.Rules
+	stopCh         chan struct{}
+	onScan         func()
+	onError        func(error)
+	log            *slog.Logger
 }
 
-func NewWatcher(mainFolder string) *Watcher {
+func NewWatcher(mainFolder string, opts Options, logger *slog.Logger) *Watcher {
 	if mainFolder == "" {
 		mainFolder = defaultFolder
 	}
+	log := logging.OrDefault(logger).With("component", "watcher")
+	rules, err := ignore.Global(mainFolder, opts.Ignore)
+	if err != nil {
+		// config.Load rejects bad patterns, so this is a programming error
+		log.Error("ignoring bad ignore patterns", "error", err)
+	}
+	formats := opts.Formats
+	if len(formats) == 0 {
+		formats = imageformat.Default
+	}
+	images, err := imageformat.NewSet(formats)
+	if err != nil {
+		log.Error("ignoring bad image formats", "error", err)
+		images, _ = imageformat.NewSet(imageformat.Default)
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
 	return &Watcher{
-		filesFound: make(map[string]time.Time),
-		mainFolder: mainFolder,
-		stopCh:     make(chan struct{}),
+		filesFound:     make(map[string]time.Time),
+		maxDeleteRatio: opts.MaxDeleteRatio,
+		parallelism:    parallelism,
+		followSymlinks: opts.FollowSymlinks,
+		images:         images,
+		mainFolder:     mainFolder,
+		ignore:         rules,
+		stopCh:         make(chan struct{}),
+		log:            log,
 	}
 }
 
-func (w *Watcher) updateFiles() {
-	type result struct {
-		path    string
-		modTime time.Time
+// updateFiles rescans the root. It fails, keeping the previous results,
+// when the root itself can't be read: an unmounted share must not look
+// like an empty library.
+func (w *Watcher) updateFiles() error {
+	if info, err := os.Stat(w.mainFolder); err != nil {
+		return w.failScan(fmt.Errorf("cannot read library root: %w", err))
+	} else if !info.IsDir() {
+		return w.failScan(fmt.Errorf("library root %s is not a folder", w.mainFolder))
 	}
-	results := make(chan result, 256)
-	var wg sync.WaitGroup
-	var traverse func(dir string)
-	traverse = func(dir string) {
-		defer wg.Done()
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return
-		}
-		for _, entry := range entries {
-			fullPath := filepath.Join(dir, entry.Name())
-			if entry.IsDir() {
-				wg.Add(1)
-				go traverse(fullPath)
-			} else if isImageFile(entry.Name()) {
-				info, err := entry.Info()
-				if err != nil {
-					continue
-				}
-				results <- result{path: fullPath, modTime: info.ModTime()}
-			}
-		}
+	wk := w.walkRoot()
+	if wk.rootErr != nil {
+		return w.failScan(fmt.Errorf("cannot read library root: %w", wk.rootErr))
 	}
-	wg.Add(1)
-	go traverse(w.mainFolder)
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	w.filesFound = make(map[string]time.Time)
-	for r := range results {
-		w.filesFound[r.path] = r.modTime
+	w.mu.Lock()
+	w.filesFound = wk.found
+	w.unreadable = wk.unreadable
+	w.report = wk.report
+	w.mu.Unlock()
+	metrics.ScanDuration.Observe(wk.report.DurationSeconds)
+	w.log.Info("scanned folder", "path", w.mainFolder, "dirs", wk.report.Dirs, "files", len(wk.found),
+		"errors", wk.report.ErrorCount, "took", time.Since(wk.report.StartedAt))
+	return nil
+}
+
+func (w *Watcher) failScan(err error) error {
+	w.mu.Lock()
+	w.report = Report{Root: w.mainFolder, StartedAt: time.Now(), Errors: []ScanError{}, Error: err.Error()}
+	w.mu.Unlock()
+	return err
+}
+
+// Report describes the last scan.
+func (w *Watcher) Report() Report {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.report
+}
+
+// Files returns the image files seen by the last scan.
+func (w *Watcher) Files() map[string]time.Time {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	files := make(map[string]time.Time, len(w.filesFound))
+	for path, modTime := range w.filesFound {
+		files[path] = modTime
 	}
+	return files
+}
+
+// OnScan registers fn to be called whenever a scan of the folder begins.
+func (w *Watcher) OnScan(fn func()) {
+	w.onScan = fn
+}
+
+// OnError registers fn to be called when a scan started by Start fails.
+func (w *Watcher) OnError(fn func(error)) {
+	w.onError = fn
 }
 
+// Compare rescans the root and diffs it against the database. It applies
+// no deletion limit; Scan and Start do.
 func (w *Watcher) Compare(ctx context.Context, database SnapshotLoader) (toIndex []string, toDelete []string, err error) {
-	w.updateFiles()
+	if w.onScan != nil {
+		w.onScan()
+	}
+	if err := w.updateFiles(); err != nil {
+		return nil, nil, err
+	}
 	return w.compareWithoutScan(ctx, database)
 }
 
@@ -84,11 +194,12 @@ func (w *Watcher) Start(ctx context.Context, database SnapshotLoader, interval t
 		for {
 			select {
 			case <-ticker.C:
-				toIndex, toDelete, err := w.Compare(ctx, database)
-				if err != nil {
-					continue
+				if err := w.Scan(ctx, database, onCompare); err != nil {
+					w.log.Error("scan failed", "error", err)
+					if w.onError != nil {
+						w.onError(err)
+					}
 				}
-				onCompare(toIndex, toDelete)
 			case <-w.stopCh:
 				return
 			case <-ctx.Done():
@@ -103,17 +214,149 @@ func (w *Watcher) Scan(ctx context.Context, database SnapshotLoader, onCompare f
 	if err != nil {
 		return err
 	}
+	if err := w.checkDeletions(len(toDelete)); err != nil {
+		return err
+	}
 	onCompare(toIndex, toDelete)
 	return nil
 }
 
+// checkDeletions holds back a scan deleting too much of the library, unless
+// ConfirmDeletions was called since the last one.
+func (w *Watcher) checkDeletions(deletions int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.confirmed {
+		w.confirmed = false
+		w.held = 0
+		return nil
+	}
+	w.held = 0
+	if err := w.exceeds(deletions); err != nil {
+		w.held = deletions
+		return err
+	}
+	return nil
+}
+
+// Exceeds reports whether deleting this many pages, as found by the last
+// Compare, is past the threshold; the result is nil when it isn't.
+func (w *Watcher) Exceeds(deletions int) *TooManyDeletionsError {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.exceeds(deletions)
+}
+
+func (w *Watcher) exceeds(deletions int) *TooManyDeletionsError {
+	if w.maxDeleteRatio <= 0 || deletions == 0 || float64(deletions) <= w.maxDeleteRatio*float64(w.known) {
+		return nil
+	}
+	return &TooManyDeletionsError{Root: w.mainFolder, Deletions: deletions, Pages: w.known, Ratio: w.maxDeleteRatio}
+}
+
+// ConfirmDeletions lets the next scan delete however many pages it finds
+// missing.
+func (w *Watcher) ConfirmDeletions() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.confirmed = true
+}
+
+// HeldDeletions is how many deletions the last scan held back, waiting for
+// ConfirmDeletions.
+func (w *Watcher) HeldDeletions() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.held
+}
+
 func (w *Watcher) Stop() {
 	close(w.stopCh)
 }
 
-func isImageFile(name string) bool {
-	ext := strings.ToLower(filepath.Ext(name))
-	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+// Explain says whether a scan picks up path, a file or folder under the
+// root or a page inside a container, and why.
+func (w *Watcher) Explain(path string) (included bool, reason string, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false, "", err
+	}
+	root := filepath.Clean(w.mainFolder)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, fmt.Sprintf("not inside %s", root), nil
+	}
+
+	file, entry, inContainer := container.Split(path)
+	if !inContainer {
+		file = path
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Walk down from the root the way a scan does, so an ignored folder
+	// hides everything below it.
+	rules, err := w.ignore.Load(root)
+	if err != nil {
+		return false, "", err
+	}
+	dir := root
+	for _, name := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if name == "." {
+			break
+		}
+		dir = filepath.Join(dir, name)
+		if !w.followSymlinks {
+			if fi, err := os.Lstat(dir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				return false, fmt.Sprintf("folder %s is a symlink, and symlinks aren't followed", dir), nil
+			}
+		}
+		if r, ok := rules.Match(dir, true); ok && !r.Negated() {
+			return false, fmt.Sprintf("folder %s is ignored by %s", dir, r), nil
+		}
+		if rules, err = rules.Load(dir); err != nil {
+			return false, "", err
+		}
+	}
+	if file == root {
+		return true, "it is the root", nil
+	}
+
+	target, isDir := file, info.IsDir()
+	if inContainer {
+		if r, ok := rules.Match(file, false); ok && !r.Negated() {
+			return false, fmt.Sprintf("container ignored by %s", r), nil
+		}
+		target, isDir = path, false
+	}
+	r, matched := rules.Match(target, isDir)
+	if matched && !r.Negated() {
+		return false, fmt.Sprintf("ignored by %s", r), nil
+	}
+	why := "no ignore rule matches"
+	if matched {
+		why = fmt.Sprintf("re-included by %s", r)
+	}
+	switch {
+	case isDir:
+		return true, "folder is scanned: " + why, nil
+	case inContainer && !container.Paged(file) && !w.images.Match(entry):
+		return false, fmt.Sprintf("%s is not an image", entry), nil
+	case !inContainer && !w.images.Match(file) && !container.IsContainer(file):
+		return false, "not an image or container", nil
+	}
+	return true, why, nil
+}
+
+func (w *Watcher) underUnreadable(path string) bool {
+	for _, dir := range w.unreadable {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 func (w *Watcher) compareWithoutScan(ctx context.Context, database SnapshotLoader) (toIndex []string, toDelete []string, err error) {
@@ -121,6 +364,8 @@ func (w *Watcher) compareWithoutScan(ctx context.Context, database SnapshotLoade
 	if err != nil {
 		return nil, nil, err
 	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	for path, modTime := range w.filesFound {
 		savedTime, exists := savedSnapshots[path]
 		if !exists {
@@ -129,7 +374,17 @@ func (w *Watcher) compareWithoutScan(ctx context.Context, database SnapshotLoade
 			toIndex = append(toIndex, path)
 		}
 	}
+	// Other libraries' pages share the table; they are not ours to delete.
+	root := strings.TrimSuffix(filepath.Clean(w.mainFolder), string(filepath.Separator)) + string(filepath.Separator)
+	w.known = 0
 	for path := range savedSnapshots {
+		if !strings.HasPrefix(path, root) {
+			continue
+		}
+		w.known++
+		if w.underUnreadable(path) {
+			continue
+		}
 		if _, exists := w.filesFound[path]; !exists {
 			toDelete = append(toDelete, path)
 		}
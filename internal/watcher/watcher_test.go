@@ -2,7 +2,13 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,7 +21,6 @@ func (m *mockDB) LoadSnapshots(ctx context.Context) (map[string]time.Time, error
 	return m.snapshots, nil
 }
 
-
 func TestIsImageFile(t *testing.T) {
 	tests := []struct {
 		input string
@@ -26,6 +31,10 @@ func TestIsImageFile(t *testing.T) {
 		{"014.png", true},
 		{"014.JPG", true},
 		{"014.PNG", true},
+		{"014.webp", true},
+		{"014.avif", true},
+		{"014.gif", true},
+		{"014.jxl", true},
 		{"readme.txt", false},
 		{"archive.zip", false},
 		{"chapter.pdf", false},
@@ -33,14 +42,20 @@ func TestIsImageFile(t *testing.T) {
 		{"noextension", false},
 	}
 
+	w := NewWatcher("", Options{}, nil)
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			got := isImageFile(tt.input)
+			got := w.images.Match(tt.input)
 			if got != tt.want {
-				t.Errorf("isImageFile(%q) = %v, want %v", tt.input, got, tt.want)
+				t.Errorf("images.Match(%q) = %v, want %v", tt.input, got, tt.want)
 			}
 		})
 	}
+
+	w = NewWatcher("", Options{Formats: []string{"jpeg", "png"}}, nil)
+	if w.images.Match("014.webp") || !w.images.Match("014.jpg") {
+		t.Error("Options.Formats is not honoured")
+	}
 }
 
 // --- Compare ---
@@ -109,6 +124,17 @@ func TestCompareWithoutScan(t *testing.T) {
 			wantToIndex:  []string{"/manga/Berserk/Chapter_057/014.jpg"},
 			wantToDelete: []string{"/manga/Berserk/Chapter_057/016.jpg"},
 		},
+		{
+			name:       "pages of another library are left alone",
+			filesFound: map[string]time.Time{},
+			snapshots: map[string]time.Time{
+				"/comics/Saga/Vol_01/001.jpg":        old,
+				"/manga-old/Berserk/ch1/001.jpg":     old,
+				"/manga/Berserk/Chapter_057/014.jpg": old,
+			},
+			wantToIndex:  []string{},
+			wantToDelete: []string{"/manga/Berserk/Chapter_057/014.jpg"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -151,4 +177,181 @@ func TestCompareWithoutScan(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// writeTree creates files (and their folders) under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateFilesIgnore(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".mangasearchignore":              "credits*.png\n",
+		"Berserk/ch1/001.png":             "",
+		"Berserk/ch1/credits.png":         "",
+		"Berserk/@eaDir/001.png":          "",
+		"Berserk/.trash/ch0/001.png":      "",
+		"Berserk/.mangasearchignore":      ".trash/\n!credits-final.png\n",
+		"Berserk/ch2/credits-final.png":   "",
+		"Vagabond/covers/cover.jpg":       "",
+		"Vagabond/ch1/001.jpg":            "",
+		"Vagabond/ch1/.mangasearchignore": "/002.jpg\n",
+		"Vagabond/ch1/002.jpg":            "",
+		"Vagabond/ch1/sub/002.jpg":        "",
+	})
+	w := NewWatcher(root, Options{Ignore: []string{"@eaDir/", "/Vagabond/covers/"}}, nil)
+	if err := w.updateFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for path := range w.Files() {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{
+		"Berserk/ch1/001.png",
+		"Berserk/ch2/credits-final.png",
+		"Vagabond/ch1/001.jpg",
+		"Vagabond/ch1/sub/002.jpg",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".mangasearchignore":            "@eaDir/\ncredits*\n",
+		"Berserk/ch1/001.png":           "",
+		"Berserk/ch1/credits.png":       "",
+		"Berserk/ch1/notes.txt":         "",
+		"Berserk/@eaDir/001.png":        "",
+		"Berserk/.mangasearchignore":    "!credits-final.png\n",
+		"Berserk/ch1/credits-final.png": "",
+	})
+	w := NewWatcher(root, Options{}, nil)
+	tests := []struct {
+		path     string
+		included bool
+		reason   string
+	}{
+		{"Berserk/ch1/001.png", true, "no ignore rule matches"},
+		{"Berserk/ch1/credits.png", false, ".mangasearchignore:2: credits*"},
+		{"Berserk/ch1/credits-final.png", true, "re-included by"},
+		{"Berserk/ch1/notes.txt", false, "not an image"},
+		{"Berserk/@eaDir/001.png", false, "folder " + filepath.Join(root, "Berserk", "@eaDir") + " is ignored"},
+		{"Berserk/ch1", true, "folder is scanned"},
+	}
+	for _, tt := range tests {
+		included, reason, err := w.Explain(filepath.Join(root, filepath.FromSlash(tt.path)))
+		if err != nil {
+			t.Fatalf("Explain(%s): %v", tt.path, err)
+		}
+		if included != tt.included || !strings.Contains(reason, tt.reason) {
+			t.Errorf("Explain(%s) = %v, %q; want %v and a reason mentioning %q", tt.path, included, reason, tt.included, tt.reason)
+		}
+	}
+	if included, reason, _ := w.Explain("/somewhere/else.png"); included || !strings.Contains(reason, "not inside") {
+		t.Errorf("Explain outside the root = %v, %q", included, reason)
+	}
+}
+
+func TestScanUnreadableRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "unmounted")
+	database := &mockDB{snapshots: map[string]time.Time{
+		filepath.Join(root, "Berserk", "ch1", "001.png"): time.Now(),
+	}}
+	w := NewWatcher(root, Options{}, nil)
+	err := w.Scan(context.Background(), database, func(toIndex, toDelete []string) {
+		t.Errorf("scan went ahead with %d deletions", len(toDelete))
+	})
+	if err == nil {
+		t.Fatal("Scan of a missing root succeeded")
+	}
+}
+
+func TestScanUnreadableArchive(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"Berserk/ch1/001.png": "",
+		"Berserk/ch2.cbz":     "not a zip",
+	})
+	now := time.Now().Add(time.Hour)
+	inArchive := filepath.Join(root, "Berserk", "ch2.cbz") + "/001.png"
+	gone := filepath.Join(root, "Berserk", "ch1", "002.png")
+	database := &mockDB{snapshots: map[string]time.Time{
+		filepath.Join(root, "Berserk", "ch1", "001.png"): now,
+		inArchive: now,
+		gone:      now,
+	}}
+	w := NewWatcher(root, Options{}, nil)
+	_, toDelete, err := w.Compare(context.Background(), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(toDelete, []string{gone}) {
+		t.Errorf("toDelete = %v, want only %s", toDelete, gone)
+	}
+}
+
+func TestScanHoldsMassDeletion(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	snapshots := make(map[string]time.Time)
+	for i := 1; i <= 10; i++ {
+		name := fmt.Sprintf("Berserk/ch1/%03d.png", i)
+		files[name] = ""
+		snapshots[filepath.Join(root, filepath.FromSlash(name))] = time.Now().Add(time.Hour)
+	}
+	writeTree(t, root, files)
+	database := &mockDB{snapshots: snapshots}
+	w := NewWatcher(root, Options{MaxDeleteRatio: 0.2}, nil)
+
+	var deleted int
+	onCompare := func(toIndex, toDelete []string) { deleted = len(toDelete) }
+
+	// Two of ten pages missing is within the limit.
+	os.Remove(filepath.Join(root, "Berserk", "ch1", "001.png"))
+	os.Remove(filepath.Join(root, "Berserk", "ch1", "002.png"))
+	if err := w.Scan(context.Background(), database, onCompare); err != nil || deleted != 2 {
+		t.Fatalf("Scan = %v with %d deletions, want 2", err, deleted)
+	}
+
+	// Losing the whole folder is not.
+	deleted = 0
+	os.RemoveAll(filepath.Join(root, "Berserk"))
+	err := w.Scan(context.Background(), database, onCompare)
+	var tooMany *TooManyDeletionsError
+	if !errors.As(err, &tooMany) || tooMany.Deletions != 10 || tooMany.Pages != 10 {
+		t.Fatalf("Scan = %v, want a TooManyDeletionsError for 10 of 10 pages", err)
+	}
+	if deleted != 0 || w.HeldDeletions() != 10 {
+		t.Errorf("deleted %d, held %d; want 0 and 10", deleted, w.HeldDeletions())
+	}
+
+	w.ConfirmDeletions()
+	if err := w.Scan(context.Background(), database, onCompare); err != nil || deleted != 10 {
+		t.Fatalf("confirmed Scan = %v with %d deletions, want 10", err, deleted)
+	}
+	if w.HeldDeletions() != 0 {
+		t.Errorf("held %d after confirming", w.HeldDeletions())
+	}
+
+	// The confirmation covers one scan only.
+	if err := w.Scan(context.Background(), database, onCompare); !errors.As(err, &tooMany) {
+		t.Errorf("second Scan = %v, want it held again", err)
+	}
+}
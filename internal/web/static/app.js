@@ -0,0 +1,139 @@
+"use strict";
+
+const form = document.getElementById("search-form");
+const statusLine = document.getElementById("status");
+const resultsList = document.getElementById("results");
+const viewer = document.getElementById("viewer");
+const viewerImage = document.getElementById("viewer-image");
+const viewerTitle = document.getElementById("viewer-title");
+const prevButton = document.getElementById("prev");
+const nextButton = document.getElementById("next");
+
+let current = null;
+
+// The key lives in a cookie so <img> requests carry it too.
+function askForKey() {
+  const key = prompt("This server needs an API key (search scope):");
+  if (!key) return false;
+  document.cookie = `mangasearch_key=${encodeURIComponent(key.trim())}; path=/; SameSite=Strict`;
+  return true;
+}
+
+async function getJSON(url, retried = false) {
+  const resp = await fetch(url);
+  const body = await resp.json().catch(() => ({}));
+  if (resp.status === 401 && !retried && askForKey()) {
+    return getJSON(url, true);
+  }
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+function renderResults(query, results) {
+  resultsList.replaceChildren();
+  if (results.length === 0) {
+    statusLine.textContent = `No results for "${query}".`;
+    return;
+  }
+  statusLine.textContent = `${results.length} result${results.length === 1 ? "" : "s"} for "${query}"`;
+
+  for (const r of results) {
+    const card = el("li", "card");
+    const thumb = el("img");
+    thumb.src = `/pages/${r.id}/thumb?w=300`;
+    thumb.alt = `${r.series} ${r.chapter} ${r.page}`;
+    thumb.loading = "lazy";
+
+    const body = el("div");
+    body.append(el("h2", "", r.series));
+    const where = el("p", "where", `${r.chapter} · ${r.page}`);
+    if (r.corrected) where.append(" ", el("span", "badge", "corrected"));
+    body.append(where);
+
+    const snippet = el("p", "snippet");
+    if (r.highlight) {
+      // Elasticsearch escapes the OCR text and only adds <mark> tags.
+      snippet.innerHTML = r.highlight;
+    } else {
+      snippet.textContent = r.block || r.text;
+    }
+    body.append(snippet);
+
+    card.append(thumb, body);
+    card.addEventListener("click", () => openPage(r.id));
+    resultsList.append(card);
+  }
+}
+
+async function runSearch(params) {
+  statusLine.textContent = "Searching…";
+  try {
+    const results = await getJSON(`/search?${params}`);
+    renderResults(params.get("q"), results);
+  } catch (err) {
+    resultsList.replaceChildren();
+    statusLine.textContent = `Search failed: ${err.message}`;
+  }
+}
+
+async function openPage(id) {
+  try {
+    current = await getJSON(`/pages/${id}`);
+  } catch (err) {
+    statusLine.textContent = `Could not open page: ${err.message}`;
+    return;
+  }
+  viewerImage.src = `/pages/${current.id}/image`;
+  viewerImage.alt = current.text;
+  viewerTitle.textContent = `${current.series} — ${current.chapter} — ${current.page}`;
+  if (current.corrected) viewerTitle.append(" ", el("span", "badge", "corrected"));
+  prevButton.disabled = !current.prev_id;
+  nextButton.disabled = !current.next_id;
+  viewer.hidden = false;
+}
+
+function closeViewer() {
+  viewer.hidden = true;
+  viewerImage.removeAttribute("src");
+  current = null;
+}
+
+form.addEventListener("submit", (event) => {
+  event.preventDefault();
+  const params = new URLSearchParams();
+  for (const [key, value] of new FormData(form)) {
+    if (value.trim() !== "") params.set(key, value.trim());
+  }
+  history.replaceState(null, "", `?${params}`);
+  runSearch(params);
+});
+
+prevButton.addEventListener("click", () => current && current.prev_id && openPage(current.prev_id));
+nextButton.addEventListener("click", () => current && current.next_id && openPage(current.next_id));
+document.getElementById("close").addEventListener("click", closeViewer);
+
+// In right-to-left books the next page is to the left.
+document.addEventListener("keydown", (event) => {
+  if (viewer.hidden) return;
+  if (event.key === "Escape") closeViewer();
+  const rtl = current && current.right_to_left;
+  if (event.key === "ArrowLeft") (rtl ? nextButton : prevButton).click();
+  if (event.key === "ArrowRight") (rtl ? prevButton : nextButton).click();
+});
+
+const initial = new URLSearchParams(location.search);
+for (const [key, value] of initial) {
+  if (form.elements[key]) form.elements[key].value = value;
+}
+if (initial.get("q")) {
+  runSearch(initial);
+}
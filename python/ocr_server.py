@@ -1,11 +1,37 @@
+from collections import defaultdict
+from typing import Optional
+
 from fastapi import FastAPI, HTTPException
 from pydantic import BaseModel
+import base64
+import cv2
 import easyocr
+import numpy as np
 import os
 
 app = FastAPI(title="MangaSearch OCR Server")
 
-reader = easyocr.Reader(['en'], gpu=False)
+DEFAULT_LANGUAGES = ('en',)
+
+# One EasyOCR reader per language combination; loading a model is slow, so
+# keep them around for the life of the process.
+readers = {DEFAULT_LANGUAGES: easyocr.Reader(list(DEFAULT_LANGUAGES), gpu=False)}
+reader = readers[DEFAULT_LANGUAGES]
+
+
+def get_reader(languages):
+    key = tuple(languages) if languages else DEFAULT_LANGUAGES
+    if key not in readers:
+        readers[key] = easyocr.Reader(list(key), gpu=False)
+    return readers[key]
+
+
+def read_options(direction):
+    # EasyOCR has no vertical text mode; trying rotated crops lets it pick
+    # up columns of tategaki text.
+    if direction == "vertical":
+        return {"rotation_info": [90, 270]}
+    return {}
 
 class OCRRequest(BaseModel):
     path: str
@@ -13,10 +39,77 @@ class OCRRequest(BaseModel):
 class OCRResponse(BaseModel):
     text: str
 
+class OCRBatchItem(BaseModel):
+    id: str
+    path: Optional[str] = None
+    image: Optional[str] = None
+    languages: list[str] = list(DEFAULT_LANGUAGES)
+    direction: str = "horizontal"
+
+class OCRBatchRequest(BaseModel):
+    items: list[OCRBatchItem]
+
+class OCRFragment(BaseModel):
+    text: str
+    confidence: float
+    box: list[float]
+
+class OCRBatchResult(BaseModel):
+    id: str
+    text: str = ""
+    fragments: list[OCRFragment] = []
+    error: Optional[str] = None
+
+class OCRBatchResponse(BaseModel):
+    results: list[OCRBatchResult]
+
+
+def load_image(item):
+    # Preprocessed pages arrive inline as base64; raw pages are read from the
+    # shared volume.
+    if item.image:
+        data = np.frombuffer(base64.b64decode(item.image), dtype=np.uint8)
+        image = cv2.imdecode(data, cv2.IMREAD_COLOR)
+        if image is None:
+            raise ValueError("Unreadable inline image")
+        return image
+    if not item.path or not os.path.exists(item.path):
+        raise FileNotFoundError(f"File not found: {item.path}")
+    image = cv2.imread(item.path)
+    if image is None:
+        raise ValueError(f"Unreadable image: {item.path}")
+    return image
+
+
+def keep_fragments(results):
+    fragments = []
+    for (bbox, text, confidence) in results:
+        text = text.strip()
+        if text and confidence > 0.4:
+            xs = [float(point[0]) for point in bbox]
+            ys = [float(point[1]) for point in bbox]
+            fragments.append(OCRFragment(
+                text=text,
+                confidence=float(confidence),
+                box=[min(xs), min(ys), max(xs), max(ys)],
+            ))
+    return fragments
+
+
+def join_fragments(results):
+    return " ".join(f.text for f in keep_fragments(results))
+
+
+def page_result(item_id, results):
+    # Grouping fragments into speech bubbles happens in Go; send the boxes
+    # along with the flat text.
+    fragments = keep_fragments(results)
+    return OCRBatchResult(id=item_id, text=" ".join(f.text for f in fragments), fragments=fragments)
+
 
 @app.get("/health")
 def health():
-    return {"status": "ok"}
+    return {"status": "ok", "engine": "easyocr", "version": easyocr.__version__}
 
 @app.post("/ocr", response_model=OCRResponse)
 def extract_text(payload: OCRRequest):
@@ -27,12 +120,47 @@ def extract_text(payload: OCRRequest):
 
     results = reader.readtext(path)
 
-    fragments = []
-    for (bbox, text, confidence) in results:
-        text = text.strip()
-        if text and confidence > 0.4:
-            fragments.append(text)
-
-    page_text = " ".join(fragments)
+    page_text = join_fragments(results)
     print(f"processing: {path}")
-    return OCRResponse(text=page_text)
\ No newline at end of file
+    return OCRResponse(text=page_text)
+
+@app.post("/ocr/batch", response_model=OCRBatchResponse)
+def extract_text_batch(payload: OCRBatchRequest):
+    results = {}
+
+    # readtext_batched needs every image in a call to share the same shape and
+    # reader, so group on both and fall back to readtext for anything left alone.
+    groups = defaultdict(list)
+    for item in payload.items:
+        try:
+            image = load_image(item)
+        except Exception as e:
+            results[item.id] = OCRBatchResult(id=item.id, error=str(e))
+            continue
+        groups[(image.shape, tuple(item.languages), item.direction)].append((item, image))
+
+    for (_, languages, direction), group in groups.items():
+        try:
+            group_reader = get_reader(languages)
+        except Exception as e:
+            for item, _ in group:
+                results[item.id] = OCRBatchResult(id=item.id, error=f"Unsupported languages {languages}: {e}")
+            continue
+        options = read_options(direction)
+        try:
+            if len(group) == 1:
+                batched = [group_reader.readtext(group[0][1], **options)]
+            else:
+                batched = group_reader.readtext_batched([image for _, image in group], **options)
+            for (item, _), page in zip(group, batched):
+                results[item.id] = page_result(item.id, page)
+        except Exception:
+            for item, image in group:
+                try:
+                    page = group_reader.readtext(image, **options)
+                    results[item.id] = page_result(item.id, page)
+                except Exception as e:
+                    results[item.id] = OCRBatchResult(id=item.id, error=str(e))
+
+    print(f"processing batch: {len(payload.items)} images")
+    return OCRBatchResponse(results=[results[item.id] for item in payload.items])